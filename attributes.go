@@ -0,0 +1,34 @@
+package cookies
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookiePriority is the value of the Priority cookie attribute, which browsers supporting it use to
+// decide which cookies to evict first when a site has too many.
+type CookiePriority string
+
+const (
+	PriorityLow    CookiePriority = "Low"
+	PriorityMedium CookiePriority = "Medium"
+	PriorityHigh   CookiePriority = "High"
+)
+
+// serializeCookie serializes cookie for use in a Set-Cookie header like http.Cookie.String does, but
+// also writes the attributes in Unparsed, which String drops.
+func serializeCookie(cookie *http.Cookie) string {
+	s := cookie.String()
+	if s == "" || len(cookie.Unparsed) == 0 {
+		return s
+	}
+
+	return s + "; " + strings.Join(cookie.Unparsed, "; ")
+}
+
+// setCookie adds a Set-Cookie header to w like http.SetCookie, using serializeCookie.
+func setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	if v := serializeCookie(cookie); v != "" {
+		w.Header().Add("Set-Cookie", v)
+	}
+}
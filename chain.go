@@ -0,0 +1,128 @@
+package cookies
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"net/http"
+)
+
+// Transform is a reversible step applied to encoded cookie values by a ChainEncoder, such as
+// compression.
+type Transform interface {
+	Forward(b []byte) ([]byte, error)
+	Reverse(b []byte) ([]byte, error)
+}
+
+// ChainEncoder wraps a CookieEncoder, applying Transforms in order to its output when encoding, and
+// reversing them in the opposite order before decoding. For instance JSONCookieEncoder followed by
+// GzipTransform compresses the JSON.
+type ChainEncoder struct {
+	Encoder    CookieEncoder
+	Transforms []Transform
+}
+
+func (e ChainEncoder) Encode(v interface{}, c *http.Cookie) error {
+	if err := e.Encoder.Encode(v, c); err != nil {
+		return err
+	}
+
+	b := []byte(c.Value)
+	for _, t := range e.Transforms {
+		var err error
+		if b, err = t.Forward(b); err != nil {
+			return err
+		}
+	}
+
+	c.Value = string(b)
+	return nil
+}
+
+func (e ChainEncoder) Decode(v interface{}, c *http.Cookie) error {
+	b := []byte(c.Value)
+	for i := len(e.Transforms) - 1; i >= 0; i-- {
+		var err error
+		if b, err = e.Transforms[i].Reverse(b); err != nil {
+			return err
+		}
+	}
+
+	c.Value = string(b)
+	return e.Encoder.Decode(v, c)
+}
+
+// DefaultMaxDecodedSize is the limit, in bytes, on inflated values used when MaxDecodedSize isn't set.
+// It's far above what fits in a cookie, while keeping decompression bombs from exhausting memory.
+const DefaultMaxDecodedSize = 64 << 10
+
+// GzipTransform gzip compresses values. Unlike CompressingCookieEncoder it always compresses them, and
+// the same caution about compressing secrets applies.
+type GzipTransform struct {
+	// MaxDecodedSize is the largest value Reverse inflates, failing with ErrDecodedTooLarge beyond it.
+	// Defaults to DefaultMaxDecodedSize when zero, a negative value disables the limit.
+	MaxDecodedSize int
+}
+
+func (GzipTransform) Forward(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t GzipTransform) Reverse(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := t.MaxDecodedSize
+	if limit == 0 {
+		limit = DefaultMaxDecodedSize
+	}
+
+	return readLimited(zr, limit, ErrDecodedTooLarge)
+}
+
+// Base64Transform base64 encodes values using Encoding, or base64.StdEncoding when it's nil. It's
+// useful for binary values that are shown or stored outside the cookie.
+type Base64Transform struct {
+	Encoding *base64.Encoding
+}
+
+func (t Base64Transform) Forward(b []byte) ([]byte, error) {
+	enc := t.encoding()
+
+	out := make([]byte, enc.EncodedLen(len(b)))
+	enc.Encode(out, b)
+
+	return out, nil
+}
+
+func (t Base64Transform) Reverse(b []byte) ([]byte, error) {
+	enc := t.encoding()
+
+	out := make([]byte, enc.DecodedLen(len(b)))
+	n, err := enc.Decode(out, b)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[:n], nil
+}
+
+func (t Base64Transform) encoding() *base64.Encoding {
+	if t.Encoding == nil {
+		return base64.StdEncoding
+	}
+
+	return t.Encoding
+}
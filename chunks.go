@@ -0,0 +1,86 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// chunkCountSeparator separates the number of chunks from the data in the first chunk. It's not part
+// of the base64 alphabet so it can't be confused with the encrypted value.
+const chunkCountSeparator = "~"
+
+// chunkName returns the name of the i-th chunk of the cookie name.
+func chunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// splitCookie splits the value of cookie across as many cookies as needed for each one to fit in
+// maxSize, up to maxChunks. The first chunk is prefixed by the total number of chunks so readers can
+// detect missing ones.
+func splitCookie(cookie *http.Cookie, maxSize, maxChunks int) ([]*http.Cookie, error) {
+	// The overhead is computed using the longest possible chunk name and count prefix so every chunk is
+	// guaranteed to fit.
+	template := *cookie
+	template.Name = chunkName(cookie.Name, maxChunks-1)
+	template.Value = strconv.Itoa(maxChunks) + chunkCountSeparator
+
+	chunkSize := maxSize - len(serializeCookie(&template))
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: %q attributes alone exceed the limit of %d", ErrCookieTooLarge, cookie.Name, maxSize)
+	}
+
+	n := (len(cookie.Value) + chunkSize - 1) / chunkSize
+	if n > maxChunks {
+		return nil, fmt.Errorf("%w: %q needs %d chunks, limit is %d", ErrCookieTooLarge, cookie.Name, n, maxChunks)
+	}
+
+	chunks := make([]*http.Cookie, n)
+	for i := range chunks {
+		end := (i + 1) * chunkSize
+		if end > len(cookie.Value) {
+			end = len(cookie.Value)
+		}
+
+		chunk := *cookie
+		chunk.Name = chunkName(cookie.Name, i)
+		chunk.Value = cookie.Value[i*chunkSize : end]
+		chunks[i] = &chunk
+	}
+	chunks[0].Value = strconv.Itoa(n) + chunkCountSeparator + chunks[0].Value
+
+	return chunks, nil
+}
+
+// joinCookie reassembles a cookie previously split by splitCookie from the request.
+func joinCookie(req *http.Request, name string, maxChunks int) (*http.Cookie, error) {
+	first, err := req.Cookie(chunkName(name, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	count, data, ok := strings.Cut(first.Value, chunkCountSeparator)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q is missing the chunk count", ErrCookieChunkMissing, name)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 || n > maxChunks {
+		return nil, fmt.Errorf("%w: %q has an invalid chunk count", ErrCookieChunkMissing, name)
+	}
+
+	var value strings.Builder
+	value.WriteString(data)
+
+	for i := 1; i < n; i++ {
+		chunk, err := req.Cookie(chunkName(name, i))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q chunk %d of %d", ErrCookieChunkMissing, name, i, n)
+		}
+
+		value.WriteString(chunk.Value)
+	}
+
+	return &http.Cookie{Name: name, Value: value.String()}, nil
+}
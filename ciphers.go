@@ -0,0 +1,432 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/divoxx/goRailsYourself/crypto"
+)
+
+// CipherMode selects the cipher used by a CookieEncryptor.
+type CipherMode int
+
+const (
+	// CBC encrypts using aes-256-cbc and signs using HMAC, the Rails default prior to 5.2. See
+	// WithKeySize for aes-128-cbc.
+	CBC CipherMode = iota
+	// GCM encrypts using aes-256-gcm authenticated encryption, the Rails default since 5.2. See
+	// WithKeySize for aes-128-gcm.
+	GCM
+	// SignOnly signs using HMAC without encrypting, leaving the value base64-readable. This matches
+	// Rails signed cookies and should only be used for data that isn't sensitive.
+	SignOnly
+)
+
+// HMACDigest selects the hash function used by the HMAC signing CBC and SignOnly messages.
+type HMACDigest int
+
+const (
+	// SHA1 signs using HMAC-SHA1, the Rails default for encrypted and signed cookies.
+	SHA1 HMACDigest = iota
+	// SHA256 signs using HMAC-SHA256, which Rails uses for signed cookies when
+	// signed_cookie_digest is set to "SHA256".
+	SHA256
+)
+
+// AESKeySize selects the length of the AES keys used by CBC and GCM messages.
+type AESKeySize int
+
+const (
+	// AES256 encrypts using 256-bit keys, aes-256-cbc or aes-256-gcm as Rails calls them.
+	AES256 AESKeySize = iota
+	// AES128 encrypts using 128-bit keys, aes-128-cbc or aes-128-gcm, for apps configuring Rails'
+	// encrypted_cookie_cipher that way.
+	AES128
+)
+
+func (k AESKeySize) bytes() int {
+	switch k {
+	case AES256:
+		return 32
+	case AES128:
+		return 16
+	default:
+		panic(fmt.Sprintf("cookies: unsupported AES key size %d", k))
+	}
+}
+
+func (d HMACDigest) hasher() func() hash.Hash {
+	switch d {
+	case SHA1:
+		return sha1.New
+	case SHA256:
+		return sha256.New
+	default:
+		panic(fmt.Sprintf("cookies: unsupported HMAC digest %d", d))
+	}
+}
+
+// messageCipher is implemented by each supported cipher mode. The additional data is authenticated
+// along with the message by ciphers supporting it, and ignored by the others.
+type messageCipher interface {
+	encrypt(value []byte, additionalData []byte) (string, error)
+	decrypt(msg string, additionalData []byte) ([]byte, error)
+}
+
+func newMessageCipher(secret string, c *encryptorConfig) messageCipher {
+	switch c.mode {
+	case CBC:
+		var (
+			key     = deriveKey(secret, c.kdf, c.iterations, saltOrDefault(c.salts.EncryptedCookie, "encrypted cookie"), c.keySize.bytes())
+			signKey = deriveKey(secret, c.kdf, c.iterations, saltOrDefault(c.salts.EncryptedSignedCookie, "signed encrypted cookie"), 64)
+		)
+
+		return &cbcMessageCipher{block: newAESCipher(key), signer: newMessageSigner(signKey, c.digest)}
+	case GCM:
+		key := deriveKey(secret, c.kdf, c.iterations, saltOrDefault(c.salts.AuthenticatedEncryptedCookie, "authenticated encrypted cookie"), c.keySize.bytes())
+
+		aead, err := cipher.NewGCMWithNonceSize(newAESCipher(key), gcmNonceSize)
+		if err != nil {
+			panic(err)
+		}
+
+		mc := &gcmMessageCipher{aead: aead}
+		if c.deterministic {
+			mc.nonceMACs = newMACPool(deriveKey(secret, c.kdf, c.iterations, "deterministic cookie nonce", 32), sha256.New)
+		}
+
+		return mc
+	case SignOnly:
+		signKey := deriveKey(secret, c.kdf, c.iterations, saltOrDefault(c.salts.SignedCookie, "signed cookie"), 64)
+
+		return &signedMessageCipher{newMessageSigner(signKey, c.digest)}
+	default:
+		panic(fmt.Sprintf("cookies: unsupported cipher mode %d", c.mode))
+	}
+}
+
+// newAESCipher creates the block cipher for key. Keys are always derived with a valid AES length, so
+// this can't fail.
+func newAESCipher(key []byte) cipher.Block {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+
+	return block
+}
+
+// saltOrDefault returns salt, or the Rails default salt def when it isn't set.
+func saltOrDefault(salt, def string) string {
+	if salt == "" {
+		return def
+	}
+
+	return salt
+}
+
+// cbcMessageCipher implements Rails' aes-256-cbc encrypt-then-sign scheme. Messages are laid out as
+// base64(base64(ciphertext)--base64(iv))--hex(hmac).
+type cbcMessageCipher struct {
+	block  cipher.Block
+	signer *messageSigner
+}
+
+func (c *cbcMessageCipher) encrypt(value []byte, additionalData []byte) (string, error) {
+	buf := getBuffer()
+	defer func() { putBuffer(buf, *buf) }()
+
+	// Values filling whole blocks aren't padded, like MessageEncryptor did, so earlier releases can
+	// still read them.
+	padding := (aes.BlockSize - len(value)%aes.BlockSize) % aes.BlockSize
+
+	b := slices.Grow((*buf)[:0], aes.BlockSize+len(value)+padding)[:aes.BlockSize]
+	iv := b
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+
+	b = append(b, value...)
+	for i := 0; i < padding; i++ {
+		b = append(b, byte(padding))
+	}
+
+	msg := getBuffer()
+	defer func() { putBuffer(msg, *msg) }()
+
+	*msg = sealCBC((*msg)[:0], c.block, iv, b[aes.BlockSize:])
+	*buf = b
+
+	return c.signer.sign(*msg), nil
+}
+
+// decrypt verifies and decrypts msg in separate steps so signature failures can be told apart from
+// decryption failures.
+func (c *cbcMessageCipher) decrypt(msg string, additionalData []byte) ([]byte, error) {
+	encryptedMsg, err := c.signer.verify(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, iv, err := parseCBCMessage(encryptedMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	cipher.NewCBCDecrypter(c.block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	return unpadCBC(ciphertext), nil
+}
+
+// unpadCBC strips the padding from a decrypted message. Rails pads values filling whole blocks with a
+// whole block of padding, which MessageEncryptor's unpadding leaves in place, so it's stripped first.
+func unpadCBC(plaintext []byte) []byte {
+	if n := len(plaintext) - aes.BlockSize; n >= 0 && bytes.Count(plaintext[n:], []byte{aes.BlockSize}) == aes.BlockSize {
+		return plaintext[:n]
+	}
+
+	return crypto.PKCS7Unpad(plaintext)
+}
+
+// sealCBC encrypts the padded plaintext in place, appending the base64(ciphertext)--base64(iv)
+// message to dst.
+func sealCBC(dst []byte, block cipher.Block, iv []byte, plaintext []byte) []byte {
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(plaintext, plaintext)
+
+	dst = base64.StdEncoding.AppendEncode(dst, plaintext)
+	dst = append(dst, "--"...)
+	return base64.StdEncoding.AppendEncode(dst, iv)
+}
+
+// parseCBCMessage decodes a base64(ciphertext)--base64(iv) message.
+func parseCBCMessage(msg []byte) ([]byte, []byte, error) {
+	data, encodedIV, ok := bytes.Cut(msg, []byte("--"))
+	if !ok || bytes.Contains(encodedIV, []byte("--")) {
+		return nil, nil, fmt.Errorf("%w: bad data (--)", ErrDecryptFailed)
+	}
+
+	// The ciphertext and IV are decoded into a single allocation.
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data))+base64.StdEncoding.DecodedLen(len(encodedIV)))
+
+	n, err := base64.StdEncoding.Decode(decoded, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	ciphertext := decoded[:n:n]
+
+	n, err = base64.StdEncoding.Decode(decoded[len(ciphertext):], encodedIV)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	iv := decoded[len(ciphertext) : len(ciphertext)+n]
+
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, nil, fmt.Errorf("%w: bad data length", ErrDecryptFailed)
+	}
+
+	return ciphertext, iv, nil
+}
+
+// signedMessageCipher implements Rails' signed message scheme, it doesn't encrypt the value.
+type signedMessageCipher struct {
+	signer *messageSigner
+}
+
+func (c *signedMessageCipher) encrypt(value []byte, additionalData []byte) (string, error) {
+	return c.signer.sign(value), nil
+}
+
+func (c *signedMessageCipher) decrypt(msg string, additionalData []byte) ([]byte, error) {
+	return c.signer.verify(msg)
+}
+
+// messageSigner signs messages the way Rails' MessageVerifier does, as base64(data)--hex(hmac).
+type messageSigner struct {
+	macs *macPool
+}
+
+func newMessageSigner(key []byte, digest HMACDigest) *messageSigner {
+	return &messageSigner{macs: newMACPool(key, digest.hasher())}
+}
+
+func (s *messageSigner) sign(data []byte) string {
+	buf := getBuffer()
+	defer func() { putBuffer(buf, *buf) }()
+
+	b := base64.StdEncoding.AppendEncode((*buf)[:0], data)
+	encodedLen := len(b)
+
+	b = append(b, "--"...)
+	b = s.appendDigest(b, b[:encodedLen])
+	*buf = b
+
+	return string(b)
+}
+
+// verify verifies msg, returning its decoded data. The digests are compared using hmac.Equal, which
+// is guaranteed to run in constant time, and malformed data is always reported.
+func (s *messageSigner) verify(msg string) ([]byte, error) {
+	data, digest, ok := strings.Cut(msg, "--")
+	if !ok || strings.Contains(digest, "--") {
+		return nil, fmt.Errorf("%w: bad data (--)", ErrInvalidSignature)
+	}
+
+	buf := getBuffer()
+	defer func() { putBuffer(buf, *buf) }()
+
+	b := append((*buf)[:0], data...)
+	b = append(b, digest...)
+	b = s.appendDigest(b, b[:len(data)])
+	*buf = b
+
+	if !hmac.Equal(b[len(data):len(data)+len(digest)], b[len(data)+len(digest):]) {
+		return nil, fmt.Errorf("%w: bad data (compare)", ErrInvalidSignature)
+	}
+
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(decoded, b[:len(data)])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+
+	return decoded[:n], nil
+}
+
+// appendDigest appends the hex encoded HMAC of data to dst.
+func (s *messageSigner) appendDigest(dst []byte, data []byte) []byte {
+	var sum [sha512.Size]byte
+
+	return hex.AppendEncode(dst, s.macs.appendSum(sum[:0], data))
+}
+
+// strictBase64 and strictRawURLBase64 reject encodings whose unused bits aren't zero, like Rails' strict_decode64, so parts
+// of messages that aren't authenticated in their encoded form can't be altered without being noticed.
+var (
+	strictBase64       = base64.StdEncoding.Strict()
+	strictRawURLBase64 = base64.RawURLEncoding.Strict()
+)
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// gcmMessageCipher implements Rails' aes-256-gcm message encryption. Messages are laid out as
+// base64(ciphertext)--base64(nonce)--base64(tag). Rails leaves the additional data empty.
+type gcmMessageCipher struct {
+	aead cipher.AEAD
+	// nonceMACs, when set, makes nonces an HMAC of the message instead of random, see
+	// WithDeterministicEncryption.
+	nonceMACs *macPool
+}
+
+func (c *gcmMessageCipher) encrypt(value []byte, additionalData []byte) (string, error) {
+	buf := getBuffer()
+	defer func() { putBuffer(buf, *buf) }()
+
+	b, err := c.nonce((*buf)[:0], value, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	b = c.aead.Seal(b, b[:gcmNonceSize], value, additionalData)
+	*buf = b
+
+	nonce, sealed := b[:gcmNonceSize], b[gcmNonceSize:]
+	ciphertext, tag := sealed[:len(sealed)-gcmTagSize], sealed[len(sealed)-gcmTagSize:]
+
+	msg := getBuffer()
+	defer func() { putBuffer(msg, *msg) }()
+
+	m := base64.StdEncoding.AppendEncode((*msg)[:0], ciphertext)
+	m = append(m, "--"...)
+	m = base64.StdEncoding.AppendEncode(m, nonce)
+	m = append(m, "--"...)
+	m = base64.StdEncoding.AppendEncode(m, tag)
+	*msg = m
+
+	return string(m), nil
+}
+
+// nonce appends the nonce used to encrypt value to dst, random unless nonceMACs is set. Deterministic
+// nonces are an HMAC-SHA256 of the additional data and value, so they only repeat for identical
+// messages.
+func (c *gcmMessageCipher) nonce(dst []byte, value []byte, additionalData []byte) ([]byte, error) {
+	if c.nonceMACs == nil {
+		dst = append(dst, make([]byte, gcmNonceSize)...)
+		if _, err := io.ReadFull(rand.Reader, dst[len(dst)-gcmNonceSize:]); err != nil {
+			return nil, err
+		}
+
+		return dst, nil
+	}
+
+	var adLen [8]byte
+	binary.BigEndian.PutUint64(adLen[:], uint64(len(additionalData)))
+
+	return c.nonceMACs.appendSum(dst, adLen[:], additionalData, value)[:len(dst)+gcmNonceSize], nil
+}
+
+func (c *gcmMessageCipher) decrypt(msg string, additionalData []byte) ([]byte, error) {
+	buf := getBuffer()
+	defer func() { putBuffer(buf, *buf) }()
+
+	*buf = append((*buf)[:0], msg...)
+
+	data, rest, ok := bytes.Cut(*buf, []byte("--"))
+	encodedNonce, encodedTag, ok2 := bytes.Cut(rest, []byte("--"))
+	if !ok || !ok2 || bytes.Contains(encodedTag, []byte("--")) {
+		return nil, fmt.Errorf("%w: bad data (--)", ErrDecryptFailed)
+	}
+
+	// The ciphertext, tag and nonce are decoded into a single allocation, the tag following the
+	// ciphertext so the message is opened in place.
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data))+
+		base64.StdEncoding.DecodedLen(len(encodedTag))+
+		base64.StdEncoding.DecodedLen(len(encodedNonce)))
+	nonceAt := len(decoded) - base64.StdEncoding.DecodedLen(len(encodedNonce))
+
+	ciphertextLen, err := strictBase64.Decode(decoded, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	nonceLen, err := strictBase64.Decode(decoded[nonceAt:], encodedNonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	tagLen, err := strictBase64.Decode(decoded[ciphertextLen:nonceAt], encodedTag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+
+	if nonceLen != gcmNonceSize {
+		return nil, fmt.Errorf("%w: bad data, invalid nonce size", ErrDecryptFailed)
+	}
+	if tagLen != gcmTagSize {
+		return nil, fmt.Errorf("%w: bad data, invalid auth tag size", ErrDecryptFailed)
+	}
+
+	sealed, nonce := decoded[:ciphertextLen+tagLen], decoded[nonceAt:nonceAt+nonceLen]
+
+	// GCM authenticates the ciphertext, so failing to open it means it was tampered with.
+	plaintext, err := c.aead.Open(sealed[:0], nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	return plaintext, nil
+}
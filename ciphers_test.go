@@ -0,0 +1,112 @@
+package cookies
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMessageSignerVerify(t *testing.T) {
+	signer := newMessageSigner(bytes.Repeat([]byte("k"), 64), SHA1)
+	msg := signer.sign([]byte("value"))
+	data, digest, _ := strings.Cut(msg, "--")
+
+	if got, err := signer.verify(msg); err != nil || string(got) != "value" {
+		t.Fatalf("verify returned %q, %v", got, err)
+	}
+
+	tampered := []byte(digest)
+	tampered[len(tampered)-1] ^= 1
+	malformed := "not base64!"
+
+	for name, msg := range map[string]string{
+		"tampered digest":            data + "--" + string(tampered),
+		"truncated digest":           data + "--" + digest[:len(digest)-2],
+		"empty digest":               data + "--",
+		"tampered data":              "dmFsdWf=--" + digest,
+		"malformed data, bad digest": malformed + "--" + digest,
+		"no separator":               data + digest,
+		"extra separator":            data + "--" + digest + "--" + digest,
+	} {
+		if _, err := signer.verify(msg); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: verify returned %v, want ErrInvalidSignature", name, err)
+		}
+	}
+
+	// Malformed data is only reported once its digest verified, so it can't be probed without the key.
+	signed := malformed + "--" + string(signer.appendDigest(nil, []byte(malformed)))
+	if _, err := signer.verify(signed); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("verifying signed malformed data returned %v, want ErrDecryptFailed", err)
+	}
+}
+
+func TestDecryptTamperedMessages(t *testing.T) {
+	for _, ce := range fuzzEncryptors() {
+		msg, err := ce.EncryptValue("value")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range msg {
+			tampered := []byte(msg)
+			tampered[i] ^= 1
+			if _, err := ce.DecryptValue(string(tampered)); err == nil {
+				t.Errorf("decrypted %q tampered at byte %d", msg, i)
+			}
+		}
+	}
+}
+
+// cipherVectors are messages in Rails' formats for the secret "vector secret", built independently of
+// this package using openssl and Python, the GCM implementation being checked against the NIST test
+// vectors first.
+var cipherVectors = []struct {
+	mode    CipherMode
+	keySize AESKeySize
+	msg     string
+	value   string
+}{
+	{CBC, AES128, "OC8xWHVZUjA0ZDVPS1dqOFJneGI3Zz09LS1BQUVDQXdRRkJnY0lDUW9MREEwT0R3PT0=--976711d1aacb2267d6bd78a05dff3ca96e060236", `{"user_id":42}`},
+	{CBC, AES128, "YkwzT3Q0bFplQWwyME9DRUh1TWtQaEcrdHY1QmNBdDdEVk0rbkFYaEMxZz0tLUFBRUNBd1FGQmdjSUNRb0xEQTBPRHc9PQ==--d58062c779df0ee4758b38ed60dd3ca5e2526771", "xxxxxxxxxxxxxxxx"},
+	{CBC, AES256, "emIvYWFlejZYS2loMW9xbHNDaHA3QT09LS1BQUVDQXdRRkJnY0lDUW9MREEwT0R3PT0=--2aa6e3506e4ab2f5f9317652771ef9ee9ae0005d", `{"user_id":42}`},
+	{CBC, AES256, "VTBLRENqNWszZElRdEVCcHEwUlFFcmU2RUgveGtXTUxmeitRV3RFbnhUdz0tLUFBRUNBd1FGQmdjSUNRb0xEQTBPRHc9PQ==--e7dc128ea22c046d7b17289506549f1d938b6473", "xxxxxxxxxxxxxxxx"},
+	{GCM, AES128, "RJWXt62m3RAb1EiXVKQ=--AAECAwQFBgcICQoL--c4+OFaEwUeSFsCmEC3lutQ==", `{"user_id":42}`},
+	{GCM, AES256, "T630U6CFGhUG2QC9ihM=--AAECAwQFBgcICQoL--oJRK3lIQyFb3/soZ4FQ1+Q==", `{"user_id":42}`},
+}
+
+func TestCipherVectors(t *testing.T) {
+	for _, v := range cipherVectors {
+		ce := NewCookieEncryptorWithOptions("vector secret", WithCipher(v.mode), WithKeySize(v.keySize))
+
+		got, err := ce.DecryptValue(v.msg)
+		if err != nil || got != v.value {
+			t.Errorf("mode %d, %d byte key: decrypted %q, %v, want %q", v.mode, v.keySize.bytes(), got, err, v.value)
+		}
+	}
+}
+
+func TestDigestMigration(t *testing.T) {
+	old := newTestManager()
+	cm := &SecureCookieManager{
+		Encryptor:          NewCookieEncryptorWithOptions("secret", WithDigest(SHA256)),
+		FallbackEncryptors: []*CookieEncryptor{old.Encryptor},
+		Encoder:            JSONCookieEncoder{},
+	}
+
+	rec := httptest.NewRecorder()
+	cookie, err := old.Set(rec, "name", &CookieOptions{}, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+	var got string
+	if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+		t.Errorf("reading a SHA1 cookie using a SHA1 fallback returned %q, %v", got, err)
+	}
+}
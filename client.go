@@ -0,0 +1,47 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// AddCookie encodes and encrypts v like Set, adding it as the cookie name to req, an outbound request
+// sent with an http.Client to a service sharing the encryptor. Cookies sent this way are never split
+// into chunks.
+func (cm *SecureCookieManager) AddCookie(req *http.Request, name string, v interface{}) error {
+	if !isCookieName(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidCookieName, name)
+	}
+
+	cookie := &http.Cookie{Name: name}
+
+	if err := cm.Encoder.Encode(v, cookie); err != nil {
+		return err
+	}
+
+	if _, err := cm.encrypt(cookie); err != nil {
+		return err
+	}
+
+	req.AddCookie(cookie)
+	return nil
+}
+
+// GetFromResponse is like Get but reads the cookie from the Set-Cookie headers of resp, a response
+// received using an http.Client. As a browser would, the last cookie set with the name is used, and
+// deleted cookies are treated as missing.
+func (cm *SecureCookieManager) GetFromResponse(resp *http.Response, name string, v interface{}) (*http.Cookie, error) {
+	latest := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		latest[cookie.Name] = cookie
+	}
+
+	req := &http.Request{Header: http.Header{}, TLS: resp.TLS}
+	for _, cookie := range latest {
+		if cookie.MaxAge >= 0 && cookie.Value != "" {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	return cm.Get(req, name, v)
+}
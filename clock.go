@@ -0,0 +1,22 @@
+package cookies
+
+import "time"
+
+// Clock provides the current time. It allows faking time when testing expiration.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the Clock used by default, backed by time.Now.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
@@ -0,0 +1,68 @@
+package cookies
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentUse hammers shared encryptors and managers from many goroutines, run it using -race
+// to check the pooled buffers and MACs are never shared.
+func TestConcurrentUse(t *testing.T) {
+	encryptors := fuzzEncryptors()
+	managers := make([]*SecureCookieManager, len(encryptors))
+	for i, ce := range encryptors {
+		managers[i] = &SecureCookieManager{Encryptor: ce, Encoder: JSONCookieEncoder{}}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				value := []byte(fmt.Sprintf("goroutine %d value %d %s", g, i, bytes.Repeat([]byte("x"), i*7)))
+				ce := encryptors[(g+i)%len(encryptors)]
+
+				msg, err := ce.EncryptBytes(value)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got, err := ce.DecryptBytes(msg); err != nil || !bytes.Equal(got, value) {
+					t.Errorf("decrypted %q, %v, want %q", got, err, value)
+					return
+				}
+
+				if _, err := ce.SignOnly().EncryptBytes(value); err != nil {
+					t.Error(err)
+					return
+				}
+
+				cm := managers[(g+i)%len(managers)]
+				rec := httptest.NewRecorder()
+				want := map[string]string{"value": string(value)}
+				cookie, err := cm.Set(rec, "session", &CookieOptions{}, want)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+				var got map[string]string
+				if _, err := cm.Get(req, "session", &got); err != nil || got["value"] != want["value"] {
+					t.Errorf("Get returned %q, %v, want %q", got["value"], err, want["value"])
+					return
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+}
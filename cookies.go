@@ -1,38 +1,71 @@
 package cookies
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strings"
 	"time"
-
-	"github.com/divoxx/goRailsYourself/crypto"
 )
 
 // CookieEncryptor implements cookie encryption and signing to allow securely storing sensitive
 // information on the user-agent.
+//
+// A CookieEncryptor is safe for concurrent use by multiple goroutines once created, as long as its
+// exported fields aren't modified.
 type CookieEncryptor struct {
-	messageEncryptor crypto.MessageEncryptor
-}
+	// BindCookieName authenticates the cookie name along with its value, so a value encrypted for a
+	// cookie can't be replayed under a different name. It only applies to GCM, and breaks
+	// compatibility with Rails.
+	BindCookieName bool
 
-// NewCookieEncryptor creates a new instance of CookieEncryptor. Creating this instance is expensive
-// since it has to derives the keys.
-func NewCookieEncryptor(secret string, iterations int) *CookieEncryptor {
-	var (
-		kg      = crypto.KeyGenerator{Secret: secret, Iterations: iterations}
-		key     = kg.CacheGenerate([]byte("encrypted cookie"), 32)
-		signKey = kg.CacheGenerate([]byte("signed encrypted cookie"), 64)
-	)
+	messageCipher   messageCipher
+	fallbackCiphers []messageCipher
+	railsSerializer RailsSerializer
+	urlSafe         bool
+	padding         int
+	versions        *versionedCiphers
+	signOnly        *lazyEncryptor
 
-	ce := &CookieEncryptor{
-		messageEncryptor: crypto.MessageEncryptor{Key: key, SignKey: signKey, Serializer: crypto.NullMsgSerializer{}},
-	}
+	// fallbacksExpireAt, when set, is the time after which fallback secrets are no longer tried.
+	fallbacksExpireAt time.Time
+	clock             Clock
+}
 
-	return ce
+// NewCookieEncryptor creates a new instance of CookieEncryptor. Creating the first instance for a given
+// secret is expensive since it has to derive the keys, they're cached so later instances using the
+// same parameters reuse them.
+//
+// Cookies are always encrypted using secret. The optional fallbackSecrets are previous secrets that
+// are tried, in order, when a cookie can't be decrypted using secret, allowing secrets to be rotated
+// without invalidating existing cookies.
+func NewCookieEncryptor(secret string, iterations int, fallbackSecrets ...string) *CookieEncryptor {
+	return NewCookieEncryptorWithCipher(secret, iterations, CBC, fallbackSecrets...)
+}
+
+// NewCookieEncryptorWithCipher is like NewCookieEncryptor but allows selecting the cipher mode. The
+// same mode is used for secret and all fallbackSecrets.
+func NewCookieEncryptorWithCipher(secret string, iterations int, mode CipherMode, fallbackSecrets ...string) *CookieEncryptor {
+	return NewCookieEncryptorWithOptions(secret, WithIterations(iterations), WithCipher(mode), WithFallbackSecrets(fallbackSecrets...))
 }
 
 // Encrypt takes an http.Cookie instance and encrypts and sign it's value, replacing it.
 func (ce *CookieEncryptor) Encrypt(cookie *http.Cookie) error {
-	encValue, err := ce.messageEncryptor.EncryptAndSign(cookie.Value)
+	value := cookie.Value
+
+	if ce.railsSerializer == RailsJSONWithMetadata {
+		var err error
+		if value, err = wrapRailsMetadata(cookie); err != nil {
+			return err
+		}
+	}
+
+	encValue, err := ce.encrypt([]byte(value), ce.additionalData(cookie))
 	if err != nil {
 		return err
 	}
@@ -41,21 +74,161 @@ func (ce *CookieEncryptor) Encrypt(cookie *http.Cookie) error {
 	return nil
 }
 
-// Decrypt takes an encrypted http.Cookie instance and decrypts it.
+// Decrypt takes an encrypted http.Cookie instance and decrypts it. The current secret is tried first,
+// followed by each fallback secret in order. If none of them succeeds the last error is returned,
+// wrapping either ErrInvalidSignature or ErrDecryptFailed. Signatures and authentication tags are
+// always compared in constant time to avoid leaking timing information.
 func (ce *CookieEncryptor) Decrypt(cookie *http.Cookie) error {
-	var value string
+	_, err := ce.decryptCookie(cookie, ce.now())
+	return err
+}
 
+// decryptCookie implements Decrypt, reporting whether a fallback secret was used. Expirations recorded
+// inside the value are checked against now, unless it's zero.
+func (ce *CookieEncryptor) decryptCookie(cookie *http.Cookie, now time.Time) (bool, error) {
 	if cookie.Value == "" {
-		return http.ErrNoCookie
+		return false, ErrCookieMissing
 	}
 
-	err := ce.messageEncryptor.DecryptAndVerify(cookie.Value, &value)
+	value, fallback, err := ce.decrypt(cookie.Value, ce.additionalData(cookie))
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	cookie.Value = value
-	return nil
+	cookie.Value = string(value)
+
+	if ce.railsSerializer == RailsJSONWithMetadata {
+		if cookie.Value, err = unwrapRailsMetadata(cookie, now); err != nil {
+			return false, err
+		}
+	}
+
+	return fallback, nil
+}
+
+// EncryptBytes encrypts and signs b, which may hold binary data. Since the result isn't tied to any
+// cookie, neither BindCookieName nor the Rails metadata envelope apply.
+func (ce *CookieEncryptor) EncryptBytes(b []byte) (string, error) {
+	return ce.encrypt(b, nil)
+}
+
+// DecryptBytes decrypts a message produced by EncryptBytes, trying fallback secrets like Decrypt.
+func (ce *CookieEncryptor) DecryptBytes(msg string) ([]byte, error) {
+	value, _, err := ce.decrypt(msg, nil)
+	return value, err
+}
+
+// EncryptValue is like EncryptBytes for string values. It allows reusing the cookie keys for other
+// data, such as signed URLs, without deriving them again.
+func (ce *CookieEncryptor) EncryptValue(value string) (string, error) {
+	return ce.EncryptBytes([]byte(value))
+}
+
+// DecryptValue decrypts a message produced by EncryptValue.
+func (ce *CookieEncryptor) DecryptValue(msg string) (string, error) {
+	b, err := ce.DecryptBytes(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// encrypt encrypts value using the current secret.
+func (ce *CookieEncryptor) encrypt(value []byte, additionalData []byte) (string, error) {
+	if ce.padding > 0 {
+		value = pad(value, ce.padding)
+	}
+
+	msg, err := ce.messageCipher.encrypt(value, additionalData)
+	if err != nil {
+		return "", err
+	}
+
+	if ce.urlSafe {
+		msg = base64.RawURLEncoding.EncodeToString([]byte(msg))
+	}
+
+	if ce.versions != nil {
+		msg = ce.versions.header() + msg
+	}
+
+	return msg, nil
+}
+
+// decrypt decrypts msg, removing its padding when padding is enabled. It reports whether a fallback
+// secret was used.
+func (ce *CookieEncryptor) decrypt(msg string, additionalData []byte) ([]byte, bool, error) {
+	value, fallback, err := ce.decryptMessage(msg, additionalData)
+	if err != nil || ce.padding == 0 {
+		return value, fallback, err
+	}
+
+	value, ok := unpad(value)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: bad padding", ErrDecryptFailed)
+	}
+
+	return value, fallback, nil
+}
+
+// decryptMessage decrypts msg using the current secret, falling back to each fallback secret in
+// order. It reports whether a fallback secret was used.
+func (ce *CookieEncryptor) decryptMessage(msg string, additionalData []byte) ([]byte, bool, error) {
+	primary, fallbacks := ce.messageCipher, ce.fallbackCiphers
+	if ce.versions != nil {
+		ciphers, rest, err := ce.versions.parse(msg)
+		if err != nil {
+			return nil, false, err
+		}
+
+		primary, fallbacks, msg = ciphers[0], ciphers[1:], rest
+	}
+
+	if ce.urlSafe {
+		b, err := strictRawURLBase64.DecodeString(msg)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+		}
+
+		msg = string(b)
+	}
+
+	value, err := primary.decrypt(msg, additionalData)
+	if err == nil || !ce.fallbacksActive() {
+		return value, false, err
+	}
+
+	for i := 0; err != nil && i < len(fallbacks); i++ {
+		value, err = fallbacks[i].decrypt(msg, additionalData)
+	}
+
+	return value, err == nil, err
+}
+
+// fallbacksActive reports whether fallback secrets can still be used.
+func (ce *CookieEncryptor) fallbacksActive() bool {
+	if ce.fallbacksExpireAt.IsZero() {
+		return true
+	}
+
+	return ce.now().Before(ce.fallbacksExpireAt)
+}
+
+func (ce *CookieEncryptor) now() time.Time {
+	if ce.clock == nil {
+		return realClock{}.Now()
+	}
+
+	return ce.clock.Now()
+}
+
+func (ce *CookieEncryptor) additionalData(cookie *http.Cookie) []byte {
+	if !ce.BindCookieName {
+		return nil
+	}
+
+	return []byte(cookie.Name)
 }
 
 // CookieEncoder encodes/decodes a specific data structure into a cookie's content.
@@ -65,19 +238,89 @@ type CookieEncoder interface {
 }
 
 // JSONCookieEncoder encodes/decodes cookies using encoding/json
-type JSONCookieEncoder struct{}
+type JSONCookieEncoder struct {
+	// UseNumber decodes numbers held in interface{} values, including map[string]interface{}, as
+	// json.Number instead of float64 so large integers such as IDs don't lose precision. Concrete
+	// numeric fields aren't affected.
+	UseNumber bool
+	// PreserveUnknownFields keeps the JSON fields not declared by structs embedding UnknownFields, so
+	// they survive a decode/encode cycle.
+	PreserveUnknownFields bool
+	// DisallowUnknownFields makes decoding fail when the cookie holds object keys not matching any
+	// field of the destination struct, rejecting cookies that don't match the expected schema.
+	DisallowUnknownFields bool
+}
 
 func (e JSONCookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	if root, ok := v.(*JSONRoot); ok {
+		v = root.Object
+		if root.IsArray {
+			v = root.Array
+		}
+	}
+
 	b, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
 
+	if e.PreserveUnknownFields {
+		if b, err = restoreUnknownFields(v, b); err != nil {
+			return err
+		}
+	}
+
 	c.Value = string(b)
 	return nil
 }
 
 func (e JSONCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	if err := e.decode(v, c); err != nil {
+		return err
+	}
+
+	if e.PreserveUnknownFields {
+		captureUnknownFields(v, []byte(c.Value))
+	}
+
+	return nil
+}
+
+func (e JSONCookieEncoder) decode(v interface{}, c *http.Cookie) error {
+	if root, ok := v.(*JSONRoot); ok {
+		return e.decodeRoot(root, c)
+	}
+
+	err := e.unmarshal(v, c)
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field == "" && (typeErr.Value == "array" || typeErr.Value == "object") {
+		return fmt.Errorf("%w: got %s, want %s: %w", ErrJSONRootMismatch, typeErr.Value, typeErr.Type, err)
+	}
+
+	return err
+}
+
+func (e JSONCookieEncoder) unmarshal(v interface{}, c *http.Cookie) error {
+	if e.UseNumber || e.DisallowUnknownFields {
+		dec := json.NewDecoder(strings.NewReader(c.Value))
+		if e.UseNumber {
+			dec.UseNumber()
+		}
+		if e.DisallowUnknownFields {
+			dec.DisallowUnknownFields()
+		}
+
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+		if dec.More() {
+			return errors.New("cookies: unexpected data after JSON value")
+		}
+
+		return nil
+	}
+
 	if err := json.Unmarshal([]byte(c.Value), v); err != nil {
 		return err
 	}
@@ -85,9 +328,170 @@ func (e JSONCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
 	return nil
 }
 
+// JSONRoot can be decoded into by a JSONCookieEncoder to accept cookies whose JSON root is either an
+// object or an array, for instance while migrating a cookie from one to the other. The value is
+// decoded into Object or Array depending on its root, and IsArray reports which one was used. Roots
+// whose destination is nil return ErrJSONRootMismatch. When encoding, Array is used if IsArray is set
+// and Object otherwise.
+type JSONRoot struct {
+	Object  interface{}
+	Array   interface{}
+	IsArray bool
+}
+
+// decodeRoot decodes c into Object or Array depending on its first non-whitespace byte.
+func (e JSONCookieEncoder) decodeRoot(root *JSONRoot, c *http.Cookie) error {
+	trimmed := strings.TrimLeft(c.Value, " \t\r\n")
+	root.IsArray = strings.HasPrefix(trimmed, "[")
+
+	target, kind := root.Object, "object"
+	if root.IsArray {
+		target, kind = root.Array, "array"
+	}
+	if target == nil {
+		return fmt.Errorf("%w: got %s, no destination for it", ErrJSONRootMismatch, kind)
+	}
+
+	return e.decode(target, c)
+}
+
+// DefaultMaxCookieSize is the size limit, in bytes, used when SecureCookieManager.MaxSize is not set.
+// It matches the minimum per-cookie size browsers are required to support by RFC 6265.
+const DefaultMaxCookieSize = 4096
+
 type SecureCookieManager struct {
 	Encryptor *CookieEncryptor
-	Encoder   CookieEncoder
+	// FallbackEncryptors are tried, in order, when a cookie can't be decrypted using Encryptor. Unlike
+	// fallback secrets they may use different iterations or cipher modes, allowing migrating between
+	// key derivations. Cookies are always written using Encryptor, so setting a cookie read using a
+	// fallback migrates it.
+	FallbackEncryptors []*CookieEncryptor
+	Encoder            CookieEncoder
+	// FallbackEncoders are tried, in order, when a decrypted cookie can't be decoded using Encoder,
+	// allowing migrating between encoders. Cookies are always written using Encoder, see Reencode.
+	// Since they're only tried once the cookie is decrypted, tampered cookies are still rejected.
+	FallbackEncoders []CookieEncoder
+	// MaxSize is the maximum length of the serialized Set-Cookie header. Defaults to
+	// DefaultMaxCookieSize when zero.
+	MaxSize int
+	// MaxChunks enables splitting cookies larger than MaxSize into up to MaxChunks cookies named
+	// name.0, name.1, etc. that are transparently reassembled by Get. Zero disables splitting.
+	MaxChunks int
+	// MaxStreamSize is the largest message DecryptFrom reads, failing with ErrMessageTooLarge beyond it.
+	// Defaults to DefaultMaxStreamSize when zero, a negative value disables the limit.
+	MaxStreamSize int
+	// SameSiteNonePolicy defines whether Set rejects or corrects cookies using SameSite=None without
+	// Secure. Defaults to rejecting them.
+	SameSiteNonePolicy SameSiteNonePolicy
+	// SubSecondMaxAgePolicy defines whether Set rejects or rounds up a MaxAge below one second.
+	// Defaults to rejecting it.
+	SubSecondMaxAgePolicy SubSecondMaxAgePolicy
+	// DefaultSameSite is the SameSite attribute of cookies whose options leave it unset. Defaults to
+	// http.SameSiteLaxMode when zero. Use http.SameSiteDefaultMode to write no attribute, leaving the
+	// choice to the browser.
+	DefaultSameSite http.SameSite
+	// Clock is used to compute expirations. Defaults to the system clock.
+	Clock Clock
+	// PartitionedFallback makes Set write Partitioned cookies a second time without the attribute,
+	// under the name suffixed by UnpartitionedSuffix, for browsers not supporting partitioned cookies.
+	// Get prefers the partitioned cookie, and Delete expires both.
+	PartitionedFallback bool
+	// SecureRequest, when set, reports whether requests were made over HTTPS. Cookies read from other
+	// requests are rejected with ErrInsecureRequest: browsers never send Secure cookies over plain
+	// HTTP, so receiving them that way hints at a misconfiguration or an attack. RequestIsTLS can be
+	// used directly, or wrapped to trust the headers of a proxy terminating TLS.
+	SecureRequest func(*http.Request) bool
+	// EnableRequestCache caches decrypted cookies in the request context, when it holds a cache
+	// installed by RequestCacheMiddleware, so reading them again while serving the request skips
+	// the crypto.
+	EnableRequestCache bool
+
+	// OnDecryptError, when set, is called whenever a cookie sent by the client fails to decrypt, for
+	// instance because it was tampered with, or is rejected by SecureRequest. The error is still
+	// returned to the caller.
+	OnDecryptError func(name string, err error)
+	// OnSet, when set, is called after a cookie is written with the size of its serialized Set-Cookie
+	// header, before any splitting into chunks.
+	OnSet func(name string, size int)
+	// Metrics, when set, collects encryption timings, decryption failures and cookie sizes.
+	Metrics Metrics
+	// Logger, when set, receives structured events for cookies written and cookies failing to
+	// decrypt, using the request context when there is one. Use SetContext and SetManyContext to pass
+	// it when writing cookies.
+	Logger *slog.Logger
+
+	// cacheOwner, when set, is the manager cm was derived from without changing how cookies are read,
+	// whose request cache entries cm shares.
+	cacheOwner *SecureCookieManager
+}
+
+// Clone returns a copy of cm sharing its encryptors, and so their derived keys, whose fields can be
+// changed without affecting cm.
+func (cm *SecureCookieManager) Clone() *SecureCookieManager {
+	clone := *cm
+	clone.FallbackEncryptors = append([]*CookieEncryptor(nil), cm.FallbackEncryptors...)
+	clone.FallbackEncoders = append([]CookieEncoder(nil), cm.FallbackEncoders...)
+	clone.cacheOwner = nil
+
+	return &clone
+}
+
+// WithEncoder returns a copy of cm, as Clone does, using enc to encode cookies. It allows using
+// different encoders for different cookies without deriving keys again. The copy shares the request
+// cache entries of cm, so fields changing how cookies are read, such as SecureRequest, must be
+// changed on a Clone instead.
+func (cm *SecureCookieManager) WithEncoder(enc CookieEncoder) *SecureCookieManager {
+	clone := cm.Clone()
+	clone.Encoder = enc
+	clone.cacheOwner = cm.requestCacheOwner()
+
+	return clone
+}
+
+// requestCacheOwner returns the manager whose request cache entries cm uses.
+func (cm *SecureCookieManager) requestCacheOwner() *SecureCookieManager {
+	if cm.cacheOwner != nil {
+		return cm.cacheOwner
+	}
+
+	return cm
+}
+
+func (cm *SecureCookieManager) metrics() Metrics {
+	if cm.Metrics == nil {
+		return noopMetrics{}
+	}
+
+	return cm.Metrics
+}
+
+func (cm *SecureCookieManager) now() time.Time {
+	if cm.Clock == nil {
+		return realClock{}.Now()
+	}
+
+	return cm.Clock.Now()
+}
+
+// sameSite returns the SameSite attribute of cookies set using s, applying DefaultSameSite when it's
+// unset.
+func (cm *SecureCookieManager) sameSite(s http.SameSite) http.SameSite {
+	switch {
+	case s != 0:
+		return s
+	case cm.DefaultSameSite != 0:
+		return cm.DefaultSameSite
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+func (cm *SecureCookieManager) maxSize() int {
+	if cm.MaxSize == 0 {
+		return DefaultMaxCookieSize
+	}
+
+	return cm.MaxSize
 }
 
 type CookieOptions struct {
@@ -95,77 +499,670 @@ type CookieOptions struct {
 	Path     string
 	HTTPOnly bool
 	Secure   bool
-	MaxAge   time.Duration
-	Expires  time.Time
-	SameSite http.SameSite
+	// MaxAge is the cookie's lifetime, truncated to whole seconds. Zero leaves it unset, and values
+	// below one second are handled according to SecureCookieManager.SubSecondMaxAgePolicy.
+	MaxAge  time.Duration
+	Expires time.Time
+	// SameSite is the cookie's SameSite attribute. Zero uses SecureCookieManager.DefaultSameSite.
+	SameSite    http.SameSite
+	Partitioned bool
+	// Priority sets the cookie's eviction priority, which is ignored by browsers not supporting it.
+	Priority CookiePriority
+	// Unparsed holds extra attributes, such as "Foo=bar", appended verbatim to the Set-Cookie header.
+	// It allows using attributes this package doesn't model yet.
+	Unparsed []string
+	// SessionOnly ensures neither Max-Age nor Expires are written regardless of MaxAge and Expires, so
+	// the cookie lasts until the browser is closed.
+	SessionOnly bool
+}
+
+// newCookie builds an empty cookie with the attributes set by the options. Both Set and Delete use
+// it so a deleting cookie always matches the attributes of the cookie it's replacing.
+func (opts *CookieOptions) newCookie(name string) *http.Cookie {
+	if opts == nil {
+		opts = &CookieOptions{}
+	}
+
+	cookie := &http.Cookie{
+		Name:        name,
+		Domain:      opts.Domain,
+		Path:        opts.Path,
+		HttpOnly:    opts.HTTPOnly,
+		Secure:      opts.Secure,
+		MaxAge:      int(opts.MaxAge.Seconds()),
+		Expires:     opts.Expires,
+		SameSite:    opts.SameSite,
+		Partitioned: opts.Partitioned,
+	}
+
+	if opts.SessionOnly {
+		cookie.MaxAge = 0
+		cookie.Expires = time.Time{}
+	}
+
+	// http.Cookie doesn't model Priority, so it's kept with the attributes written verbatim.
+	if opts.Priority != "" {
+		cookie.Unparsed = append(cookie.Unparsed, "Priority="+string(opts.Priority))
+	}
+	cookie.Unparsed = append(cookie.Unparsed, opts.Unparsed...)
+
+	return cookie
+}
+
+// ApplyTo replaces the attributes of cookie with those set by the options, the way Set does, keeping
+// its name and value. A nil opts clears them.
+func (opts *CookieOptions) ApplyTo(cookie *http.Cookie) {
+	value := cookie.Value
+
+	*cookie = *opts.newCookie(cookie.Name)
+	cookie.Value = value
+}
+
+// OptionsFromCookie returns the options setting the attributes of cookie, such as one parsed from a
+// Set-Cookie header, so they can be reused when writing other cookies. A negative MaxAge, which only
+// deletes cookies, is left unset. The Priority attribute is taken from the unparsed attributes, the
+// others being kept as is.
+func OptionsFromCookie(cookie *http.Cookie) *CookieOptions {
+	opts := &CookieOptions{
+		Domain:      cookie.Domain,
+		Path:        cookie.Path,
+		HTTPOnly:    cookie.HttpOnly,
+		Secure:      cookie.Secure,
+		Expires:     cookie.Expires,
+		SameSite:    cookie.SameSite,
+		Partitioned: cookie.Partitioned,
+	}
+
+	if cookie.MaxAge > 0 {
+		opts.MaxAge = time.Duration(cookie.MaxAge) * time.Second
+	}
+
+	for _, attr := range cookie.Unparsed {
+		if key, value, _ := strings.Cut(attr, "="); strings.EqualFold(key, "Priority") && opts.Priority == "" {
+			opts.Priority = CookiePriority(value)
+			continue
+		}
+
+		opts.Unparsed = append(opts.Unparsed, attr)
+	}
+
+	return opts
 }
 
 // Set a cookie with the data set to the encrypted version of the serialization of v.
-// Returns the http.Cookie generated.
+// Returns the http.Cookie generated. If the resulting cookie exceeds the manager's MaxSize it's split
+// into chunks when MaxChunks allows it, otherwise it isn't written and an error wrapping
+// ErrCookieTooLarge is returned.
 func (cm *SecureCookieManager) Set(w http.ResponseWriter, name string, opts *CookieOptions, v interface{}) (*http.Cookie, error) {
-	var err error
+	return cm.SetContext(context.Background(), w, name, opts, v)
+}
 
-	if opts == nil {
-		opts = &CookieOptions{}
+// SetContext is like Set but passes ctx, typically the request context, to Logger so events can be
+// correlated with the request.
+func (cm *SecureCookieManager) SetContext(ctx context.Context, w http.ResponseWriter, name string, opts *CookieOptions, v interface{}) (*http.Cookie, error) {
+	cookie, err := cm.newCookie(name, opts)
+	if err != nil {
+		return cookie, err
+	}
+
+	if err := cm.Encoder.Encode(v, cookie); err != nil {
+		return cookie, err
+	}
+
+	return cookie, cm.write(ctx, w, cookie, opts)
+}
+
+// SetRaw is like Set but stores value as is, without encoding it. It's the counterpart of GetRaw.
+func (cm *SecureCookieManager) SetRaw(w http.ResponseWriter, name string, opts *CookieOptions, value string) (*http.Cookie, error) {
+	return cm.setRaw(context.Background(), w, name, opts, value)
+}
+
+// setRaw implements SetRaw, passing ctx to Logger.
+func (cm *SecureCookieManager) setRaw(ctx context.Context, w http.ResponseWriter, name string, opts *CookieOptions, value string) (*http.Cookie, error) {
+	cookie, err := cm.newCookie(name, opts)
+	if err != nil {
+		return cookie, err
+	}
+
+	cookie.Value = value
+	return cookie, cm.write(ctx, w, cookie, opts)
+}
+
+// CookieWrite describes a cookie written by SetMany.
+type CookieWrite struct {
+	Name    string
+	Options *CookieOptions
+	Value   interface{}
+}
+
+// SetMany sets each of the cookies in writes, as Set does, for responses writing several related
+// cookies such as the session, CSRF and remember-me ones. Headers can't be written atomically, but every
+// cookie is encoded and encrypted before any of them is written: if one fails none are written and the
+// error is returned. OnSet and Metrics are still called for the cookies prepared before the failure.
+func (cm *SecureCookieManager) SetMany(w http.ResponseWriter, writes []CookieWrite) ([]*http.Cookie, error) {
+	return cm.SetManyContext(context.Background(), w, writes)
+}
+
+// SetManyContext is like SetMany but passes ctx to Logger, as SetContext does.
+func (cm *SecureCookieManager) SetManyContext(ctx context.Context, w http.ResponseWriter, writes []CookieWrite) ([]*http.Cookie, error) {
+	buf := headerBuffer{}
+	cookies := make([]*http.Cookie, 0, len(writes))
+
+	for _, cw := range writes {
+		cookie, err := cm.SetContext(ctx, buf, cw.Name, cw.Options, cw.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		cookies = append(cookies, cookie)
 	}
 
-	cookie := http.Cookie{
-		Name:     name,
-		Domain:   opts.Domain,
-		Path:     opts.Path,
-		HttpOnly: opts.HTTPOnly,
-		Secure:   opts.Secure,
-		MaxAge:   int(opts.MaxAge.Seconds()),
-		Expires:  opts.Expires,
-		SameSite: opts.SameSite,
+	for _, v := range buf.Header().Values("Set-Cookie") {
+		w.Header().Add("Set-Cookie", v)
 	}
 
-	if err := cm.Encoder.Encode(v, &cookie); err != nil {
-		return &cookie, err
+	return cookies, nil
+}
+
+// headerBuffer is an http.ResponseWriter only collecting headers, used to hold cookies before writing
+// them.
+type headerBuffer http.Header
+
+func (b headerBuffer) Header() http.Header {
+	return http.Header(b)
+}
+
+func (b headerBuffer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (b headerBuffer) WriteHeader(int) {}
+
+// newCookie builds and validates an empty cookie with the attributes set by opts.
+func (cm *SecureCookieManager) newCookie(name string, opts *CookieOptions) (*http.Cookie, error) {
+	cookie := opts.newCookie(name)
+	cookie.SameSite = cm.sameSite(cookie.SameSite)
+	if err := cm.validateMaxAge(cookie, opts); err != nil {
+		return cookie, err
 	}
+	cm.reconcileExpiration(cookie)
+
+	return cookie, cm.validate(cookie)
+}
 
-	if err = cm.Encryptor.Encrypt(&cookie); err != nil {
-		return &cookie, err
+// EstimateSize returns the length of the Set-Cookie header Set would write for v, without writing it.
+// It runs the same encoding and encryption, so the estimate is accurate. Cookies above MaxSize aren't
+// reported as errors, allowing callers to compare the size against their own budget.
+func (cm *SecureCookieManager) EstimateSize(name string, opts *CookieOptions, v interface{}) (int, error) {
+	cookie, err := cm.newCookie(name, opts)
+	if err != nil {
+		return 0, err
 	}
 
-	http.SetCookie(w, &cookie)
-	return &cookie, nil
+	if err := cm.Encoder.Encode(v, cookie); err != nil {
+		return 0, err
+	}
+
+	// Encrypting directly keeps estimates out of the encryption metrics.
+	if err := cm.Encryptor.Encrypt(cookie); err != nil {
+		return 0, err
+	}
+
+	return serializedSize(cookie)
 }
 
-// Get gets the Cookie, decrypted it and deserialized it into v.
-// Returns the decrypted cookie.
-func (cm *SecureCookieManager) Get(req *http.Request, name string, v interface{}) (*http.Cookie, error) {
-	cookie, err := req.Cookie(name)
+// encrypt encrypts the cookie and returns the length of its serialized Set-Cookie header.
+func (cm *SecureCookieManager) encrypt(cookie *http.Cookie) (int, error) {
+	start := time.Now()
+	if err := cm.Encryptor.Encrypt(cookie); err != nil {
+		return 0, err
+	}
+	cm.metrics().ObserveEncrypt(time.Since(start))
+
+	return serializedSize(cookie)
+}
+
+// serializedSize checks the value of the encrypted cookie and returns the length of its serialized
+// Set-Cookie header.
+func serializedSize(cookie *http.Cookie) (int, error) {
+	if err := validateValue(cookie); err != nil {
+		return 0, err
+	}
+
+	return len(serializeCookie(cookie)), nil
+}
+
+// write encrypts the cookie and writes it to w, splitting it into chunks if needed.
+func (cm *SecureCookieManager) write(ctx context.Context, w http.ResponseWriter, cookie *http.Cookie, opts *CookieOptions) error {
+	if cm.PartitionedFallback && cookie.Partitioned {
+		if err := cm.writeUnpartitioned(ctx, w, cookie, opts); err != nil {
+			return err
+		}
+	}
+
+	size, err := cm.encrypt(cookie)
+	if err != nil {
+		return err
+	}
+
+	return cm.emit(ctx, w, cookie, opts, size)
+}
+
+// emit writes the encrypted cookie, whose serialized size is size, to w, splitting it into chunks if
+// needed.
+func (cm *SecureCookieManager) emit(ctx context.Context, w http.ResponseWriter, cookie *http.Cookie, opts *CookieOptions, size int) error {
+	if maxSize := cm.maxSize(); size <= maxSize {
+		setCookie(w, cookie)
+	} else {
+		if cm.MaxChunks == 0 {
+			return fmt.Errorf("%w: %q is %d bytes, limit is %d", ErrCookieTooLarge, cookie.Name, size, maxSize)
+		}
+
+		chunks, err := splitCookie(cookie, maxSize, cm.MaxChunks)
+		if err != nil {
+			return err
+		}
+
+		// Expire the unsplit cookie, otherwise Get would keep reading its stale value.
+		setCookie(w, cm.expiredCookie(cookie.Name, opts))
+		for _, chunk := range chunks {
+			setCookie(w, chunk)
+		}
+	}
+
+	if cm.OnSet != nil {
+		cm.OnSet(cookie.Name, size)
+	}
+	cm.metrics().ObserveCookieSize(size)
+	cm.log(ctx, slog.LevelDebug, "cookie set", slog.String("cookie", cookie.Name), slog.Int("size", size))
+
+	return nil
+}
+
+// Touch re-issues the named cookie sent with req using opts, typically to extend its lifetime, without
+// decoding or re-encrypting it. The cookie is read the way Get does first, so cookies Get would reject
+// aren't refreshed. Expirations stored inside the value, such as the one used by
+// CookieSessionManager.ExpiresIn, aren't extended.
+func (cm *SecureCookieManager) Touch(w http.ResponseWriter, req *http.Request, name string, opts *CookieOptions) (*http.Cookie, error) {
+	_, value, _, err := cm.readEncrypted(req, name)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := cm.Encryptor.Decrypt(cookie); err != nil {
+	cookie, err := cm.newCookie(name, opts)
+	if err != nil {
 		return cookie, err
 	}
 
-	if err := cm.Encoder.Decode(v, cookie); err != nil {
-		return cookie, err
+	cookie.Value = value
+	return cookie, cm.emit(req.Context(), w, cookie, opts, len(serializeCookie(cookie)))
+}
+
+// Migrate moves the cookie oldName to newName, for instance when adding a prefix such as __Host- to
+// the session cookie: the old cookie is read into v, written as newName using opts and deleted, all in
+// the same response. It reports whether the cookie was migrated. When the request already carries a
+// valid newName cookie it's read into v instead, and only the old cookie is deleted, if present. The
+// old cookie is deleted using opts, so it must have been set using the same Domain and Path. Requests
+// carrying neither cookie return ErrCookieMissing.
+func (cm *SecureCookieManager) Migrate(w http.ResponseWriter, req *http.Request, oldName, newName string, opts *CookieOptions, v interface{}) (bool, error) {
+	if _, err := cm.Get(req, newName, v); err == nil {
+		if _, err := cm.lookup(req, oldName); err == nil {
+			_, err = cm.Delete(w, oldName, opts)
+			return false, err
+		}
+
+		return false, nil
 	}
 
-	return cookie, nil
+	if _, err := cm.Get(req, oldName, v); err != nil {
+		return false, err
+	}
+
+	if _, err := cm.SetContext(req.Context(), w, newName, opts, v); err != nil {
+		return false, err
+	}
+
+	if _, err := cm.Delete(w, oldName, opts); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// reconcileExpiration sets Expires from MaxAge, or MaxAge from Expires, when only one of them is set so
+// clients honoring only one of the attributes agree on the cookie's lifetime.
+func (cm *SecureCookieManager) reconcileExpiration(cookie *http.Cookie) {
+	switch {
+	case cookie.MaxAge > 0 && cookie.Expires.IsZero():
+		cookie.Expires = cm.now().Add(time.Duration(cookie.MaxAge) * time.Second)
+	case cookie.MaxAge == 0 && !cookie.Expires.IsZero():
+		if maxAge := int(math.Ceil(cookie.Expires.Sub(cm.now()).Seconds())); maxAge > 0 {
+			cookie.MaxAge = maxAge
+		} else {
+			cookie.MaxAge = -1
+		}
+	}
+}
+
+// Get gets the Cookie, decrypted it and deserialized it into v. When the request carries several
+// cookies with the name, for instance set for both a parent domain and a subdomain, the first one that
+// decrypts is used. Returns the decrypted cookie. Errors can be told apart using errors.Is with
+// ErrCookieMissing, ErrInvalidSignature, ErrDecryptFailed and ErrDecodeFailed.
+func (cm *SecureCookieManager) Get(req *http.Request, name string, v interface{}) (*http.Cookie, error) {
+	cookie, _, err := cm.get(req, name, v)
+	return cookie, err
 }
 
-// Deletes the Cookie, setting value to empty and expiring in the past.
+// get implements Get, reporting whether the cookie was decrypted using a fallback secret or encryptor,
+// or decoded using a fallback encoder, and should be rewritten.
+func (cm *SecureCookieManager) get(req *http.Request, name string, v interface{}) (*http.Cookie, bool, error) {
+	cookie, stale, err := cm.read(req, name)
+	if err != nil {
+		return cookie, false, err
+	}
+
+	fallback, err := cm.decode(v, cookie)
+	if err != nil {
+		return cookie, false, err
+	}
+
+	return cookie, stale || fallback, nil
+}
+
+// decode decodes the decrypted cookie into v using Encoder, falling back to each of FallbackEncoders
+// in order. It reports whether a fallback encoder was used. If none of them succeeds the error from
+// Encoder is returned, since the fallbacks failing is expected once cookies are migrated.
+func (cm *SecureCookieManager) decode(v interface{}, cookie *http.Cookie) (bool, error) {
+	value := cookie.Value
+
+	err := cm.Encoder.Decode(v, cookie)
+	if err == nil {
+		return false, nil
+	}
+
+	for _, enc := range cm.FallbackEncoders {
+		cookie.Value = value
+		if enc.Decode(v, cookie) == nil {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+}
+
+// Reencode rewrites the named cookie using Encoder when it was decoded using one of
+// FallbackEncoders, for instance when migrating from JSONCookieEncoder to another encoder, or
+// decrypted using a fallback secret or encryptor. The cookie is read into v and, if needed, set again
+// using opts. It reports whether the cookie was rewritten.
+func (cm *SecureCookieManager) Reencode(w http.ResponseWriter, req *http.Request, name string, opts *CookieOptions, v interface{}) (bool, error) {
+	_, stale, err := cm.get(req, name, v)
+	if err != nil || !stale {
+		return false, err
+	}
+
+	if _, err := cm.SetContext(req.Context(), w, name, opts, v); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetOrDefault is like Get but treats a missing cookie as the normal case: it reports whether the
+// cookie was present, leaving v untouched when it wasn't, and only returns an error for cookies that
+// are present but can't be read.
+func (cm *SecureCookieManager) GetOrDefault(req *http.Request, name string, v interface{}) (bool, error) {
+	_, err := cm.Get(req, name, v)
+	if err == ErrCookieMissing {
+		return false, nil
+	}
+
+	return true, err
+}
+
+// GetFromHeader is like Get but reads the cookie from a raw Cookie header, for contexts where the
+// header is available without an http.Request. Like Get, when multiple cookies share the same name the
+// first one that decrypts is used. Malformed headers return an error wrapping ErrMalformedCookieHeader.
+func (cm *SecureCookieManager) GetFromHeader(header string, name string, v interface{}) (*http.Cookie, error) {
+	if _, err := http.ParseCookie(header); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedCookieHeader, err)
+	}
+
+	return cm.Get(&http.Request{Header: http.Header{"Cookie": {header}}}, name, v)
+}
+
+// GetRaw gets the Cookie and returns its decrypted value without decoding it. It's useful for cookies
+// holding plain values, such as tokens, and for inspecting cookies.
+func (cm *SecureCookieManager) GetRaw(req *http.Request, name string) (string, error) {
+	cookie, _, err := cm.read(req, name)
+	if err != nil {
+		return "", err
+	}
+
+	return cookie.Value, nil
+}
+
+// Verify checks the request carries the named cookie and that it's correctly signed and decrypts,
+// without decoding it. It's cheaper than Get for telling apart requests with a valid cookie.
+func (cm *SecureCookieManager) Verify(req *http.Request, name string) error {
+	_, _, err := cm.read(req, name)
+	return err
+}
+
+// GetIgnoringExpiry is like Get but also decodes cookies whose expiration recorded inside the value,
+// such as the one in Rails' metadata envelope, has passed, reporting whether it had. It's meant for
+// inspecting cookies in support and admin tooling, and must never be used to authenticate requests.
+// The cookie's signature is still verified.
+func (cm *SecureCookieManager) GetIgnoringExpiry(req *http.Request, name string, v interface{}) (*http.Cookie, bool, error) {
+	cookie, err := cm.lookup(req, name)
+	if err == ErrCookieMissing && cm.PartitionedFallback {
+		cookie, err = cm.lookup(req, unpartitionedName(name))
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	value := cookie.Value
+	_, err = cm.decrypt(cookie)
+
+	expired := errors.Is(err, ErrCookieExpired)
+	if expired {
+		cookie.Value = value
+		_, err = cm.decryptAt(cookie, time.Time{})
+	}
+	if err != nil {
+		return cookie, false, err
+	}
+
+	if _, err := cm.decode(v, cookie); err != nil {
+		return cookie, expired, err
+	}
+
+	return cookie, expired, nil
+}
+
+// NeedsRewrite reports whether the named cookie sent with req was encrypted using a fallback secret or
+// encryptor rather than the current one, without decoding it. Setting the cookie again migrates it to
+// the current key. Cookies that can't be decrypted using any of them return an error, as Verify does.
+func (cm *SecureCookieManager) NeedsRewrite(req *http.Request, name string) (bool, error) {
+	_, stale, err := cm.read(req, name)
+	return stale, err
+}
+
+// read gets the Cookie, reassembling it from chunks if needed, and decrypts it. It reports whether a
+// fallback secret or encryptor was used.
+func (cm *SecureCookieManager) read(req *http.Request, name string) (*http.Cookie, bool, error) {
+	cookie, _, stale, err := cm.readEncrypted(req, name)
+	return cookie, stale, err
+}
+
+// readEncrypted implements read, also returning the encrypted value of the cookie.
+func (cm *SecureCookieManager) readEncrypted(req *http.Request, name string) (*http.Cookie, string, bool, error) {
+	var rc *requestCache
+	if cm.EnableRequestCache {
+		rc = requestCacheFrom(req)
+	}
+
+	// Insecure requests are rejected even when the cookie is cached.
+	insecure := cm.SecureRequest != nil && !cm.SecureRequest(req)
+
+	key := requestCacheKey{manager: cm.requestCacheOwner(), encryptor: cm.Encryptor, name: name}
+	if rc != nil && !insecure {
+		if entry, ok := rc.get(key); ok {
+			return &entry.cookie, entry.encrypted, entry.stale, nil
+		}
+	}
+
+	cookie, err := cm.lookup(req, name)
+	if err == ErrCookieMissing && cm.PartitionedFallback {
+		cookie, err = cm.lookup(req, unpartitionedName(name))
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	var (
+		encrypted string
+		stale     bool
+	)
+	if insecure {
+		err = fmt.Errorf("%w: %q", ErrInsecureRequest, name)
+	} else {
+		cookie, encrypted, stale, err = cm.decryptShadowed(req, cookie)
+	}
+	if err != nil {
+		if err != ErrCookieMissing {
+			if cm.OnDecryptError != nil {
+				cm.OnDecryptError(name, err)
+			}
+			cm.metrics().IncDecryptFailure(decryptFailureReason(err))
+			cm.logDecryptError(req.Context(), name, err)
+		}
+
+		return cookie, "", false, err
+	}
+
+	if rc != nil {
+		rc.set(key, requestCacheEntry{cookie: *cookie, encrypted: encrypted, stale: stale})
+	}
+
+	return cookie, encrypted, stale, nil
+}
+
+// decryptShadowed decrypts the cookie, also returning its encrypted value. When it fails, the other
+// cookies sent with the same name, which browsers send when cookies set for overlapping domains or
+// paths shadow each other, are tried in order and the first one that decrypts is returned. Otherwise
+// the first cookie's error is returned.
+func (cm *SecureCookieManager) decryptShadowed(req *http.Request, cookie *http.Cookie) (*http.Cookie, string, bool, error) {
+	encrypted := cookie.Value
+	stale, err := cm.decrypt(cookie)
+	if err == nil {
+		return cookie, encrypted, stale, nil
+	}
+
+	shadowed := req.CookiesNamed(cookie.Name)
+	for i := 1; i < len(shadowed); i++ {
+		value := shadowed[i].Value
+		if stale, err := cm.decrypt(shadowed[i]); err == nil {
+			return shadowed[i], value, stale, nil
+		}
+	}
+
+	return cookie, "", false, err
+}
+
+// RequestIsTLS reports whether req was received over TLS. It can be used as
+// SecureCookieManager.SecureRequest.
+func RequestIsTLS(req *http.Request) bool {
+	return req.TLS != nil
+}
+
+// lookup gets the Cookie, reassembling it from chunks if needed.
+func (cm *SecureCookieManager) lookup(req *http.Request, name string) (*http.Cookie, error) {
+	cookie, err := req.Cookie(name)
+	if err == ErrCookieMissing && cm.MaxChunks > 0 {
+		cookie, err = joinCookie(req, name, cm.MaxChunks)
+	}
+
+	return cookie, err
+}
+
+// decrypt decrypts the cookie using Encryptor, falling back to each of FallbackEncryptors in order.
+// It reports whether a fallback secret or encryptor was used. If none of them succeeds the last error
+// is returned.
+func (cm *SecureCookieManager) decrypt(cookie *http.Cookie) (bool, error) {
+	return cm.decryptAt(cookie, cm.now())
+}
+
+// decryptAt is like decrypt but checks the expirations recorded inside the value against now, or not
+// at all when it's zero.
+func (cm *SecureCookieManager) decryptAt(cookie *http.Cookie, now time.Time) (bool, error) {
+	value := cookie.Value
+
+	stale, err := cm.Encryptor.decryptCookie(cookie, now)
+	for i := 0; err != nil && err != ErrCookieMissing && i < len(cm.FallbackEncryptors); i++ {
+		cookie.Value = value
+		if _, err = cm.FallbackEncryptors[i].decryptCookie(cookie, now); err == nil {
+			return true, nil
+		}
+	}
+
+	return stale, err
+}
+
+// Deletes the Cookie, setting value to empty and expiring in the past. When MaxChunks is set all the
+// chunks the cookie may have been split into are expired as well.
 func (cm *SecureCookieManager) Delete(w http.ResponseWriter, name string, opts *CookieOptions) (*http.Cookie, error) {
-	if opts == nil {
-		opts = &CookieOptions{}
+	cookie := cm.expiredCookie(name, opts)
+	setCookie(w, cookie)
+
+	for i := 0; i < cm.MaxChunks; i++ {
+		setCookie(w, cm.expiredCookie(chunkName(name, i), opts))
+	}
+
+	if cm.PartitionedFallback && opts != nil && opts.Partitioned {
+		if _, err := cm.Delete(w, unpartitionedName(name), opts.unpartitioned()); err != nil {
+			return cookie, err
+		}
+	}
+
+	return cookie, nil
+}
+
+// DeleteAll deletes each of the named cookies, as Delete does, using the same opts for all of them.
+// It's convenient for clearing the session, CSRF and similar cookies when logging out.
+func (cm *SecureCookieManager) DeleteAll(w http.ResponseWriter, names []string, opts *CookieOptions) error {
+	for _, name := range names {
+		if _, err := cm.Delete(w, name, opts); err != nil {
+			return err
+		}
 	}
 
-	cookie := http.Cookie{
-		Name:     name,
-		HttpOnly: opts.HTTPOnly,
-		Domain:   opts.Domain,
-		Secure:   opts.Secure,
-		Path:     opts.Path,
-		MaxAge:   -1,
+	return nil
+}
+
+// CookieNamesWithPrefix returns the names of the cookies sent with req starting with prefix, in the
+// order they were sent and without duplicates. It's useful for finding chunks or versions of a
+// cookie to pass to DeleteAll.
+func CookieNamesWithPrefix(req *http.Request, prefix string) []string {
+	var names []string
+	seen := map[string]bool{}
+
+	for _, cookie := range req.Cookies() {
+		if strings.HasPrefix(cookie.Name, prefix) && !seen[cookie.Name] {
+			seen[cookie.Name] = true
+			names = append(names, cookie.Name)
+		}
 	}
 
-	http.SetCookie(w, &cookie)
-	return &cookie, nil
+	return names
+}
+
+// expiredCookie builds a cookie that deletes the cookie name previously set using opts.
+func (cm *SecureCookieManager) expiredCookie(name string, opts *CookieOptions) *http.Cookie {
+	cookie := opts.newCookie(name)
+	cookie.SameSite = cm.sameSite(cookie.SameSite)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Time{}
+
+	return cookie
 }
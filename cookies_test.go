@@ -0,0 +1,171 @@
+package cookies
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// requestWithCookies returns a request carrying the cookies written to rec, the way a browser would
+// send them back.
+func requestWithCookies(rec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	return req
+}
+
+// setCookieRequest writes v as the cookie name using cm, returning a request carrying it.
+func setCookieRequest(t *testing.T, cm *SecureCookieManager, name string, v interface{}) *http.Request {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if _, err := cm.Set(rec, name, &CookieOptions{}, v); err != nil {
+		t.Fatal(err)
+	}
+
+	return requestWithCookies(rec)
+}
+
+func TestTouchReissuesCookie(t *testing.T) {
+	cm := newTestManager()
+	req := setCookieRequest(t, cm, "name", "value")
+	value, _ := req.Cookie("name")
+
+	rec := httptest.NewRecorder()
+	cookie, err := cm.Touch(rec, req, "name", &CookieOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie.Value != value.Value || cookie.MaxAge != 3600 {
+		t.Errorf("touching re-issued %q with MaxAge %d, want the same value with MaxAge 3600", cookie.Value, cookie.MaxAge)
+	}
+
+	// A shadowing cookie that doesn't decrypt is skipped, as Get does.
+	shadowed := httptest.NewRequest(http.MethodGet, "/", nil)
+	shadowed.Header.Set("Cookie", "name=tampered; name="+value.Value)
+	cookie, err = cm.Touch(httptest.NewRecorder(), shadowed, "name", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookie.Value != value.Value {
+		t.Errorf("touching a shadowed cookie re-issued %q, want %q", cookie.Value, value.Value)
+	}
+}
+
+func TestTouchRejectsCookiesGetRejects(t *testing.T) {
+	issued := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issued
+	cm := &SecureCookieManager{
+		Encryptor: NewCookieEncryptorWithOptions("secret", WithRailsSerializer(RailsJSONWithMetadata)),
+		Encoder:   JSONCookieEncoder{},
+		Clock:     ClockFunc(func() time.Time { return now }),
+	}
+
+	rec := httptest.NewRecorder()
+	if _, err := cm.Set(rec, "name", &CookieOptions{Expires: issued.Add(time.Hour)}, "value"); err != nil {
+		t.Fatal(err)
+	}
+	valid := requestWithCookies(rec)
+
+	tampered := httptest.NewRequest(http.MethodGet, "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: "name", Value: "tampered"})
+
+	insecure := cm.Clone()
+	insecure.SecureRequest = RequestIsTLS
+
+	for _, tt := range []struct {
+		name string
+		cm   *SecureCookieManager
+		req  *http.Request
+		now  time.Time
+		want error
+	}{
+		{"tampered", cm, tampered, issued, ErrInvalidSignature},
+		{"expired", cm, valid, issued.Add(2 * time.Hour), ErrCookieExpired},
+		{"insecure", insecure, valid, issued, ErrInsecureRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			now = tt.now
+
+			rec := httptest.NewRecorder()
+			if _, err := tt.cm.Touch(rec, tt.req, "name", &CookieOptions{MaxAge: time.Hour}); !errors.Is(err, tt.want) {
+				t.Errorf("touching returned %v, want %v", err, tt.want)
+			}
+			if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+				t.Errorf("touching wrote %d cookies, want none", len(cookies))
+			}
+		})
+	}
+}
+
+func TestSecureRequest(t *testing.T) {
+	cm := newTestManager()
+	cm.SecureRequest = RequestIsTLS
+	cm.EnableRequestCache = true
+
+	var failures []error
+	cm.OnDecryptError = func(name string, err error) { failures = append(failures, err) }
+
+	secure := setCookieRequest(t, cm, "name", "value")
+	secure.TLS = &tls.ConnectionState{}
+	secure = secure.WithContext(ContextWithRequestCache(secure.Context()))
+
+	var got string
+	if _, err := cm.Get(secure, "name", &got); err != nil || got != "value" {
+		t.Fatalf("got %q, %v over TLS, want %q", got, err, "value")
+	}
+
+	// The cookie read over TLS is cached, which mustn't let plain HTTP requests read it.
+	insecure := secure.Clone(secure.Context())
+	insecure.TLS = nil
+
+	if _, err := cm.Get(insecure, "name", &got); !errors.Is(err, ErrInsecureRequest) {
+		t.Errorf("reading over plain HTTP returned %v, want ErrInsecureRequest", err)
+	}
+	if _, err := cm.Touch(httptest.NewRecorder(), insecure, "name", nil); !errors.Is(err, ErrInsecureRequest) {
+		t.Errorf("touching over plain HTTP returned %v, want ErrInsecureRequest", err)
+	}
+	if len(failures) != 2 || !errors.Is(failures[0], ErrInsecureRequest) {
+		t.Errorf("OnDecryptError was called with %v, want ErrInsecureRequest twice", failures)
+	}
+
+	if _, err := cm.Get(httptest.NewRequest(http.MethodGet, "/", nil), "name", &got); err != ErrCookieMissing {
+		t.Errorf("reading a missing cookie over plain HTTP returned %v, want ErrCookieMissing", err)
+	}
+}
+
+func TestGetSkipsShadowedCookies(t *testing.T) {
+	cm := newTestManager()
+	first, _ := setCookieRequest(t, cm, "name", "first").Cookie("name")
+	second, _ := setCookieRequest(t, cm, "name", "second").Cookie("name")
+	other, _ := setCookieRequest(t, &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("other secret"), Encoder: JSONCookieEncoder{}}, "name", "other").Cookie("name")
+
+	for _, tt := range []struct {
+		name   string
+		values []string
+		want   string
+		err    error
+	}{
+		{"first decrypts", []string{first.Value, second.Value}, "first", nil},
+		{"second decrypts", []string{other.Value, second.Value}, "second", nil},
+		{"neither decrypts", []string{"tampered", other.Value}, "", ErrInvalidSignature},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, value := range tt.values {
+			req.AddCookie(&http.Cookie{Name: "name", Value: value})
+		}
+
+		var got string
+		if _, err := cm.Get(req, "name", &got); !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
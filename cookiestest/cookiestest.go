@@ -0,0 +1,146 @@
+// Package cookiestest provides utilities for testing code using the cookies package.
+package cookiestest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/doximity/cookies"
+)
+
+// RoundTrip sets v in the cookie name using cm and returns a request carrying the cookies it wrote,
+// ready to be read back using cm.Get.
+func RoundTrip(cm *cookies.SecureCookieManager, name string, opts *cookies.CookieOptions, v interface{}) (*http.Request, error) {
+	rec := httptest.NewRecorder()
+	if _, err := cm.Set(rec, name, opts, v); err != nil {
+		return nil, err
+	}
+
+	return NewRequest(rec), nil
+}
+
+// NewRequest returns a GET request carrying the non-expired cookies written to rec, as a browser
+// would send them on the next request.
+func NewRequest(rec *httptest.ResponseRecorder) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	return req
+}
+
+// MockSessionManager is an in-memory cookies.SessionManager without any encryption, meant for unit
+// tests. Sessions must be pointers to structs. It's safe for concurrent use.
+type MockSessionManager struct {
+	mu      sync.Mutex
+	session cookies.Session
+
+	// Err, when set, is returned by Current and Update.
+	Err error
+	// Updates counts the calls to Update.
+	Updates int
+}
+
+// NewMockSessionManager creates a new MockSessionManager whose current session is sess, which may be
+// nil to start without one.
+func NewMockSessionManager(sess cookies.Session) *MockSessionManager {
+	return &MockSessionManager{session: sess}
+}
+
+// Current copies the stored session into sess, returning cookies.ErrCookieMissing when there is none.
+func (sm *MockSessionManager) Current(req *http.Request, sess cookies.Session) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.Err != nil {
+		return sm.Err
+	}
+
+	if sm.session == nil {
+		return cookies.ErrCookieMissing
+	}
+
+	return copySession(sess, sm.session)
+}
+
+// Update stores a copy of sess as the current session.
+func (sm *MockSessionManager) Update(w http.ResponseWriter, req *http.Request, sess cookies.Session) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.Updates++
+	if sm.Err != nil {
+		return sm.Err
+	}
+
+	typ := reflect.TypeOf(sess)
+	if typ.Kind() != reflect.Pointer {
+		return errSessionType
+	}
+
+	dst := reflect.New(typ.Elem()).Interface().(cookies.Session)
+	if err := copySession(dst, sess); err != nil {
+		return err
+	}
+
+	sm.session = dst
+	return nil
+}
+
+// Session returns the stored session.
+func (sm *MockSessionManager) Session() cookies.Session {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.session
+}
+
+var errSessionType = errors.New("cookiestest: sessions must be pointers of the same type")
+
+func copySession(dst, src cookies.Session) error {
+	dv, sv := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if dv.Kind() != reflect.Pointer || sv.Kind() != reflect.Pointer || dv.Type() != sv.Type() {
+		return errSessionType
+	}
+
+	dv.Elem().Set(sv.Elem())
+	return nil
+}
+
+// RecordingMetrics is a cookies.Metrics recording every measurement, meant for asserting on them in
+// tests. It's safe for concurrent use.
+type RecordingMetrics struct {
+	mu sync.Mutex
+
+	Encrypts        []time.Duration
+	DecryptFailures []string
+	CookieSizes     []int
+}
+
+func (m *RecordingMetrics) ObserveEncrypt(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Encrypts = append(m.Encrypts, d)
+}
+
+func (m *RecordingMetrics) IncDecryptFailure(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.DecryptFailures = append(m.DecryptFailures, reason)
+}
+
+func (m *RecordingMetrics) ObserveCookieSize(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.CookieSizes = append(m.CookieSizes, n)
+}
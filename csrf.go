@@ -0,0 +1,78 @@
+package cookies
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// CSRFManager implements double-submit CSRF protection. A random token is stored in an encrypted
+// cookie and must be echoed back by the client, typically in a form field or header, for the request
+// to be accepted.
+type CSRFManager struct {
+	cm   *SecureCookieManager
+	name string
+	opts *CookieOptions
+}
+
+// NewCSRFManager creates a new CSRF manager storing tokens in the cookie name.
+func NewCSRFManager(cm *SecureCookieManager, name string, opts *CookieOptions) *CSRFManager {
+	return &CSRFManager{cm: cm, name: name, opts: opts}
+}
+
+// Token returns the CSRF token to embed in the response. The token already written to w or sent with
+// req is reused, otherwise a new one is generated and its cookie written to w.
+func (csrf *CSRFManager) Token(w http.ResponseWriter, req *http.Request) (string, error) {
+	if token, ok := csrf.pending(w); ok {
+		return token, nil
+	}
+
+	if token, err := csrf.cm.GetRaw(req, csrf.name); err == nil && token != "" {
+		return token, nil
+	}
+
+	return csrf.Rotate(w)
+}
+
+// Rotate replaces the CSRF token by a new one, writing its cookie to w. Session managers call it when
+// regenerating sessions if configured to do so.
+func (csrf *CSRFManager) Rotate(w http.ResponseWriter) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := csrf.cm.SetRaw(w, csrf.name, csrf.opts, token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyCSRF checks token, as submitted by the client, against the one stored in the request cookie.
+// It returns ErrInvalidCSRFToken when they don't match or the cookie can't be read.
+func (csrf *CSRFManager) VerifyCSRF(req *http.Request, token string) error {
+	stored, err := csrf.cm.GetRaw(req, csrf.name)
+	if err != nil || stored == "" || subtle.ConstantTimeCompare([]byte(stored), []byte(token)) != 1 {
+		return ErrInvalidCSRFToken
+	}
+
+	return nil
+}
+
+// pending returns the token already written to w, if any.
+func (csrf *CSRFManager) pending(w http.ResponseWriter) (string, bool) {
+	lines := w.Header().Values("Set-Cookie")
+	for i := len(lines) - 1; i >= 0; i-- {
+		cookie, err := http.ParseSetCookie(lines[i])
+		if err != nil || cookie.Name != csrf.name {
+			continue
+		}
+
+		if cookie.MaxAge < 0 || csrf.cm.Encryptor.Decrypt(cookie) != nil {
+			return "", false
+		}
+		return cookie.Value, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,94 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// csrfRequest returns a request carrying a CSRF cookie, and the token it holds.
+func csrfRequest(t *testing.T, csrf *CSRFManager) (*http.Request, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	token, err := csrf.Token(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return requestWithCookies(rec), token
+}
+
+func TestCSRFManagerVerify(t *testing.T) {
+	csrf := NewCSRFManager(newTestManager(), "csrf", nil)
+	req, token := csrfRequest(t, csrf)
+	_, other := csrfRequest(t, csrf)
+
+	for _, tt := range []struct {
+		name  string
+		req   *http.Request
+		token string
+		want  error
+	}{
+		{"valid", req, token, nil},
+		{"missing token", req, "", ErrInvalidCSRFToken},
+		{"mismatched token", req, other, ErrInvalidCSRFToken},
+		{"missing cookie", httptest.NewRequest(http.MethodPost, "/", nil), token, ErrInvalidCSRFToken},
+	} {
+		if err := csrf.VerifyCSRF(tt.req, tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: verifying returned %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Tokens aren't accepted from cookies that aren't encrypted.
+	forged := httptest.NewRequest(http.MethodPost, "/", nil)
+	forged.AddCookie(&http.Cookie{Name: "csrf", Value: "token"})
+	if err := csrf.VerifyCSRF(forged, "token"); !errors.Is(err, ErrInvalidCSRFToken) {
+		t.Errorf("verifying a forged cookie returned %v, want ErrInvalidCSRFToken", err)
+	}
+}
+
+func TestCSRFManagerReusesToken(t *testing.T) {
+	csrf := NewCSRFManager(newTestManager(), "csrf", nil)
+	req, token := csrfRequest(t, csrf)
+
+	rec := httptest.NewRecorder()
+	if got, err := csrf.Token(rec, req); err != nil || got != token {
+		t.Errorf("token sent with the request is %q, %v, want %q", got, err, token)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("reusing the token wrote %d cookies, want none", len(cookies))
+	}
+}
+
+func TestCSRFTokenRotatesOnRegenerate(t *testing.T) {
+	cm := newTestManager()
+	csrf := NewCSRFManager(cm, "csrf", nil)
+	sm := NewCookieSessionManager(cm, "session", nil)
+	sm.CSRF = csrf
+
+	req, token := csrfRequest(t, csrf)
+
+	rec := httptest.NewRecorder()
+	if err := sm.Regenerate(rec, req, &testSession{UserID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Token returns the rotated token written to the response.
+	rotated, err := csrf.Token(rec, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == token {
+		t.Fatal("regenerating the session kept the CSRF token")
+	}
+
+	next := requestWithCookies(rec)
+	if err := csrf.VerifyCSRF(next, token); !errors.Is(err, ErrInvalidCSRFToken) {
+		t.Errorf("verifying the token from before the regeneration returned %v, want ErrInvalidCSRFToken", err)
+	}
+	if err := csrf.VerifyCSRF(next, rotated); err != nil {
+		t.Errorf("verifying the rotated token returned %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package cookies
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DedupResponseWriter wraps an http.ResponseWriter, collapsing the Set-Cookie headers written for the
+// same cookie into the last one before the response headers are sent. Browsers only keep the last
+// one anyway, so this saves bytes when a session is updated several times while serving a request.
+// Cookies are the same when their name, domain and path match, so a cookie set for one path isn't
+// dropped in favor of one set for another.
+type DedupResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// NewDedupResponseWriter wraps w in a DedupResponseWriter.
+func NewDedupResponseWriter(w http.ResponseWriter) *DedupResponseWriter {
+	return &DedupResponseWriter{ResponseWriter: w}
+}
+
+// DedupMiddleware wraps the http.ResponseWriter passed to next in a DedupResponseWriter.
+func DedupMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		dw := NewDedupResponseWriter(w)
+		next.ServeHTTP(dw, req)
+
+		// Handlers not writing a body leave the headers to be sent once they return.
+		dw.dedup()
+	})
+}
+
+func (w *DedupResponseWriter) WriteHeader(statusCode int) {
+	w.dedup()
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *DedupResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.dedup()
+		w.wroteHeader = true
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the wrapped writer does.
+func (w *DedupResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.dedup()
+		w.wroteHeader = true
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *DedupResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// dedup collapses the Set-Cookie headers written so far, unless the headers were already sent.
+func (w *DedupResponseWriter) dedup() {
+	if w.wroteHeader {
+		return
+	}
+
+	h := w.Header()
+	values := h.Values("Set-Cookie")
+	if len(values) < 2 {
+		return
+	}
+
+	type cookieKey struct{ name, domain, path string }
+
+	// Keep each cookie at the position of its last write, leaving unparseable headers alone.
+	last := make(map[cookieKey]int, len(values))
+	keys := make([]*cookieKey, len(values))
+	for i, v := range values {
+		cookie, err := http.ParseSetCookie(v)
+		if err != nil {
+			continue
+		}
+
+		key := cookieKey{cookie.Name, strings.ToLower(cookie.Domain), cookie.Path}
+		last[key], keys[i] = i, &key
+	}
+
+	if len(last) == len(values) {
+		return
+	}
+
+	deduped := make([]string, 0, len(last))
+	for i, v := range values {
+		if keys[i] == nil || last[*keys[i]] == i {
+			deduped = append(deduped, v)
+		}
+	}
+
+	h["Set-Cookie"] = deduped
+}
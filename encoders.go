@@ -0,0 +1,187 @@
+package cookies
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GobCookieEncoder encodes/decodes cookies using encoding/gob. Since gob is a binary format the
+// output is base64 encoded.
+type GobCookieEncoder struct{}
+
+func (e GobCookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("cookies: can't gob encode %T: %w", v, err)
+	}
+
+	c.Value = base64.StdEncoding.EncodeToString(buf.Bytes())
+	return nil
+}
+
+func (e GobCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	b, err := base64.StdEncoding.DecodeString(c.Value)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		return fmt.Errorf("cookies: can't gob decode into %T: %w", v, err)
+	}
+
+	return nil
+}
+
+// BinaryCookieEncoder encodes/decodes cookies using the value's own encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler implementations. The output is base64 encoded.
+type BinaryCookieEncoder struct{}
+
+func (e BinaryCookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	m, ok := v.(encoding.BinaryMarshaler)
+	if !ok {
+		return fmt.Errorf("cookies: %T doesn't implement encoding.BinaryMarshaler", v)
+	}
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	c.Value = base64.StdEncoding.EncodeToString(b)
+	return nil
+}
+
+func (e BinaryCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	u, ok := v.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("cookies: %T doesn't implement encoding.BinaryUnmarshaler", v)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(c.Value)
+	if err != nil {
+		return err
+	}
+
+	return u.UnmarshalBinary(b)
+}
+
+const (
+	uncompressedMarker byte = 0x00
+	gzipMarker         byte = 0x01
+)
+
+// FormCookieEncoder encodes/decodes cookies holding url-encoded key/value pairs, as written by
+// systems storing url.Values in cookies. Values must be url.Values or map[string]string, or pointers to
+// them when decoding.
+type FormCookieEncoder struct{}
+
+func (e FormCookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	switch v := v.(type) {
+	case url.Values:
+		c.Value = v.Encode()
+	case *url.Values:
+		c.Value = v.Encode()
+	case map[string]string:
+		c.Value = formValues(v).Encode()
+	case *map[string]string:
+		c.Value = formValues(*v).Encode()
+	default:
+		return fmt.Errorf("cookies: FormCookieEncoder can't encode %T, use url.Values or map[string]string", v)
+	}
+
+	return nil
+}
+
+func (e FormCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	values, err := url.ParseQuery(c.Value)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string]string:
+		*v = make(map[string]string, len(values))
+		for key := range values {
+			(*v)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("cookies: FormCookieEncoder can't decode into %T, use *url.Values or *map[string]string", v)
+	}
+
+	return nil
+}
+
+func formValues(m map[string]string) url.Values {
+	values := make(url.Values, len(m))
+	for key, value := range m {
+		values.Set(key, value)
+	}
+
+	return values
+}
+
+// CompressingCookieEncoder wraps a CookieEncoder, gzip compressing its output before it's encrypted.
+// The value is only compressed when that actually makes it smaller, a leading marker byte records
+// which was the case so Decode knows whether to inflate it.
+//
+// Compression makes the length of encrypted cookies depend on their contents, as exploited by the
+// CRIME and BREACH attacks: when a cookie holds secrets, such as tokens, along with data an attacker
+// can influence, observing its length for chosen inputs reveals the secrets. Don't compress such
+// cookies, or keep secrets in separate ones.
+type CompressingCookieEncoder struct {
+	Encoder CookieEncoder
+	// MaxDecodedSize is the largest value Decode inflates, see GzipTransform.MaxDecodedSize.
+	MaxDecodedSize int
+}
+
+func (e CompressingCookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	if err := e.Encoder.Encode(v, c); err != nil {
+		return err
+	}
+
+	compressed, err := GzipTransform{}.Forward([]byte(c.Value))
+	if err != nil {
+		return err
+	}
+
+	if len(compressed) < len(c.Value) {
+		c.Value = string(gzipMarker) + string(compressed)
+	} else {
+		c.Value = string(uncompressedMarker) + c.Value
+	}
+
+	return nil
+}
+
+func (e CompressingCookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	if c.Value == "" {
+		return errors.New("cookies: missing compression marker")
+	}
+
+	marker, data := c.Value[0], c.Value[1:]
+
+	switch marker {
+	case uncompressedMarker:
+		c.Value = data
+	case gzipMarker:
+		b, err := GzipTransform{MaxDecodedSize: e.MaxDecodedSize}.Reverse([]byte(data))
+		if err != nil {
+			return err
+		}
+
+		c.Value = string(b)
+	default:
+		return errors.New("cookies: unknown compression marker")
+	}
+
+	return e.Encoder.Decode(v, c)
+}
@@ -0,0 +1,300 @@
+package cookies
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultIterations is the number of PBKDF2 iterations used to derive keys when not set, matching
+// Rails' default.
+const DefaultIterations = 1000
+
+type encryptorConfig struct {
+	iterations      int
+	mode            CipherMode
+	kdf             KeyDerivation
+	fallbackSecrets []string
+	bindCookieName  bool
+	railsSerializer RailsSerializer
+	salts           RailsSalts
+	urlSafe         bool
+	fallbacksExpire time.Time
+	clock           Clock
+	versioned       bool
+	digest          HMACDigest
+	keySize         AESKeySize
+	padding         int
+	deterministic   bool
+
+	signingSecret             string
+	fallbackSigningSecrets    []string
+	fallbackEncryptionSecrets []string
+}
+
+// EncryptorOption configures a CookieEncryptor created by NewCookieEncryptorWithOptions.
+type EncryptorOption func(*encryptorConfig)
+
+// WithIterations sets the number of PBKDF2 iterations used to derive keys. Defaults to
+// DefaultIterations.
+func WithIterations(iterations int) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.iterations = iterations
+	}
+}
+
+// WithCipher sets the cipher mode. Defaults to CBC.
+func WithCipher(mode CipherMode) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.mode = mode
+	}
+}
+
+// WithDigest sets the hash function used by the HMAC signing CBC and SignOnly messages. Defaults to
+// SHA1, matching Rails' defaults and cookies written by earlier releases of this package, since
+// changing it would invalidate them. GCM messages aren't affected.
+//
+// SHA256 is preferable for new deployments. Existing ones can switch by keeping an encryptor using
+// SHA1 in SecureCookieManager.FallbackEncryptors until the cookies it wrote have expired. Values
+// written using WithVersionedFormat record their digest, so they're read whichever one is configured.
+func WithDigest(d HMACDigest) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.digest = d
+	}
+}
+
+// WithKeySize sets the length of the AES keys derived for CBC and GCM messages. Defaults to AES256.
+// It applies to every format version read by encryptors using WithVersionedFormat, since the version
+// header doesn't record it.
+func WithKeySize(k AESKeySize) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.keySize = k
+	}
+}
+
+// WithKeyDerivation sets the function used to derive keys from secrets. Defaults to PBKDF2. Only
+// PBKDF2 and PBKDF2SHA256, used by Rails 7.0 and later, are compatible with Rails, so the others should
+// only be used when cookies are exclusively read by Go applications.
+func WithKeyDerivation(kdf KeyDerivation) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.kdf = kdf
+	}
+}
+
+// WithFallbackSecrets adds previous secrets tried, in order, when a cookie can't be decrypted using the
+// current one.
+func WithFallbackSecrets(secrets ...string) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.fallbackSecrets = append(c.fallbackSecrets, secrets...)
+	}
+}
+
+// WithSigningSecret signs messages using a key derived from secret instead of from the encryptor's
+// secret, which is then only used for encryption. It applies to CBC and SignOnly.
+func WithSigningSecret(secret string) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.signingSecret = secret
+	}
+}
+
+// WithFallbackSigningSecrets adds previous signing secrets accepted when verifying messages, allowing
+// signing secrets to be rotated independently of encryption secrets. It applies to CBC and SignOnly.
+func WithFallbackSigningSecrets(secrets ...string) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.fallbackSigningSecrets = append(c.fallbackSigningSecrets, secrets...)
+	}
+}
+
+// WithFallbackEncryptionSecrets adds previous encryption secrets accepted when decrypting messages,
+// allowing encryption secrets to be rotated independently of signing secrets. It applies to CBC and
+// GCM.
+//
+// With CBC, messages written by these encryptors record which secret they were encrypted with.
+// Messages written elsewhere, such as by Rails or by encryptors without split secrets, are only read
+// when signed using the same secret they were encrypted with, as those are, since the signature then
+// identifies it: such values signed using a separate signing secret can't be read through the fallback
+// encryption secrets.
+func WithFallbackEncryptionSecrets(secrets ...string) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.fallbackEncryptionSecrets = append(c.fallbackEncryptionSecrets, secrets...)
+	}
+}
+
+// WithCookieNameBinding authenticates cookie names along with their values. See
+// CookieEncryptor.BindCookieName.
+func WithCookieNameBinding() EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.bindCookieName = true
+	}
+}
+
+// WithRailsSerializer sets how values are laid out inside the encrypted payload to match the Rails app
+// sharing the cookies. Defaults to RailsJSON.
+func WithRailsSerializer(s RailsSerializer) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.railsSerializer = s
+	}
+}
+
+// RailsSalts holds the salts used to derive each key, named after the Rails settings holding them.
+// Empty salts keep the Rails defaults.
+type RailsSalts struct {
+	// EncryptedCookie is encrypted_cookie_salt, deriving the CBC encryption key.
+	EncryptedCookie string
+	// EncryptedSignedCookie is encrypted_signed_cookie_salt, deriving the CBC signing key.
+	EncryptedSignedCookie string
+	// AuthenticatedEncryptedCookie is authenticated_encrypted_cookie_salt, deriving the GCM key.
+	AuthenticatedEncryptedCookie string
+	// SignedCookie is signed_cookie_salt, deriving the SignOnly signing key.
+	SignedCookie string
+}
+
+// WithRailsSalts sets the salts used to derive keys, matching a Rails app that customized them.
+func WithRailsSalts(salts RailsSalts) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.salts = salts
+	}
+}
+
+// WithSalts sets the salts used to derive the encryption and signing keys, matching a Rails app that
+// customized them. The encryption salt is Rails' encrypted_cookie_salt for CBC and
+// authenticated_encrypted_cookie_salt for GCM, the signing salt is encrypted_signed_cookie_salt.
+// Empty salts keep the Rails defaults. SignOnly keys keep using signed_cookie_salt, so they're never
+// the CBC signing keys: use WithRailsSalts to customize it.
+func WithSalts(encryptionSalt, signingSalt string) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.salts.EncryptedCookie = encryptionSalt
+		c.salts.AuthenticatedEncryptedCookie = encryptionSalt
+		c.salts.EncryptedSignedCookie = signingSalt
+	}
+}
+
+// WithURLSafeEncoding base64url-encodes, without padding, the encrypted values so they never need
+// quoting in cookies or URLs. Values encoded this way can't be read by Rails, and values that aren't
+// are rejected with ErrDecryptFailed.
+func WithURLSafeEncoding() EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.urlSafe = true
+	}
+}
+
+// WithPadding pads values to a multiple of blockSize bytes before encrypting them, so the length of
+// encrypted cookies doesn't reveal the exact length of their contents. Since encoders run first,
+// compressed values are padded after compression. The padding is encrypted along with the value, and
+// only removed by encryptors padding their values: those reject values that aren't padded with
+// ErrDecryptFailed, so values written before enabling padding are read by listing an encryptor without
+// padding in SecureCookieManager.FallbackEncryptors. Padded values can't be read by Rails.
+func WithPadding(blockSize int) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.padding = blockSize
+	}
+}
+
+// WithDeterministicEncryption makes encrypting the same value always produce the same message, by
+// deriving nonces from the value instead of picking them at random, so encrypted identifiers can be
+// indexed server-side. It only applies to GCM, and messages are still read by any GCM encryptor sharing
+// the secret.
+//
+// This is weaker than the default: anyone seeing two cookies can tell whether they hold the same
+// value. Only use it for values where that's acceptable, never for sessions.
+func WithDeterministicEncryption() EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.deterministic = true
+	}
+}
+
+// WithVersionedFormat prefixes encrypted values with a two-byte version header identifying how they
+// were encrypted, so values written using other cipher modes by encryptors sharing the same secrets
+// can still be read, easing format changes. Values without the header, such as those written before
+// enabling it, are read using the configured cipher mode. Versioned values can't be read by Rails.
+func WithVersionedFormat() EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.versioned = true
+	}
+}
+
+// WithFallbackGracePeriod stops trying fallback secrets once grace has elapsed since rotatedAt, so
+// previous secrets are retired automatically after a rotation has rolled out.
+func WithFallbackGracePeriod(rotatedAt time.Time, grace time.Duration) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.fallbacksExpire = rotatedAt.Add(grace)
+	}
+}
+
+// WithClock sets the clock used to check the fallback grace period, and by Decrypt to check the
+// expirations recorded by RailsJSONWithMetadata. Defaults to the system clock.
+func WithClock(clock Clock) EncryptorOption {
+	return func(c *encryptorConfig) {
+		c.clock = clock
+	}
+}
+
+// NewRotatingEncryptor creates a CookieEncryptor for a secret rotation: cookies are encrypted using
+// newSecret, and cookies encrypted using oldSecret are accepted until grace has elapsed since
+// rotatedAt. opts may set any other option.
+func NewRotatingEncryptor(newSecret, oldSecret string, rotatedAt time.Time, grace time.Duration, opts ...EncryptorOption) *CookieEncryptor {
+	opts = append([]EncryptorOption{WithFallbackSecrets(oldSecret), WithFallbackGracePeriod(rotatedAt, grace)}, opts...)
+	return NewCookieEncryptorWithOptions(newSecret, opts...)
+}
+
+// NewCookieEncryptorWithOptions creates a new instance of CookieEncryptor configured by opts. Like
+// NewCookieEncryptor, creating the first instance for a given secret is expensive since it has to
+// derive the keys.
+func NewCookieEncryptorWithOptions(secret string, opts ...EncryptorOption) *CookieEncryptor {
+	c := encryptorConfig{iterations: DefaultIterations, mode: CBC}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return newCookieEncryptor(secret, c)
+}
+
+// newCookieEncryptor creates a CookieEncryptor using the configuration c.
+func newCookieEncryptor(secret string, c encryptorConfig) *CookieEncryptor {
+	ciphers := newCiphers(secret, &c)
+	ce := &CookieEncryptor{
+		BindCookieName:  c.bindCookieName,
+		messageCipher:   ciphers[0],
+		fallbackCiphers: ciphers[1:],
+		railsSerializer: c.railsSerializer,
+		urlSafe:         c.urlSafe,
+		padding:         c.padding,
+
+		fallbacksExpireAt: c.fallbacksExpire,
+		clock:             c.clock,
+	}
+
+	if c.versioned {
+		ce.versions = newVersionedCiphers(secret, &c, ciphers)
+	}
+
+	if c.mode != SignOnly {
+		signOnly := c
+		signOnly.mode = SignOnly
+		ce.signOnly = &lazyEncryptor{build: func() *CookieEncryptor { return newCookieEncryptor(secret, signOnly) }}
+	}
+
+	return ce
+}
+
+// NewCookieEncryptorContext is like NewCookieEncryptorWithOptions using the given PBKDF2 iterations,
+// but gives up returning ctx.Err() once ctx is done, so deriving keys using many iterations doesn't
+// block shutdown. The derivation keeps running in the background and its keys are still cached.
+func NewCookieEncryptorContext(ctx context.Context, secret string, iterations int, opts ...EncryptorOption) (*CookieEncryptor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	opts = append([]EncryptorOption{WithIterations(iterations)}, opts...)
+
+	done := make(chan *CookieEncryptor, 1)
+	go func() {
+		done <- NewCookieEncryptorWithOptions(secret, opts...)
+	}()
+
+	select {
+	case ce := <-done:
+		return ce, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,269 @@
+package cookies
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFallbackSecrets(t *testing.T) {
+	for _, m := range []struct {
+		name string
+		mode CipherMode
+	}{
+		{"CBC", CBC},
+		{"GCM", GCM},
+		{"SignOnly", SignOnly},
+	} {
+		t.Run(m.name, func(t *testing.T) {
+			rotated := NewCookieEncryptorWithOptions("new secret", WithCipher(m.mode), WithFallbackSecrets("older secret", "old secret"))
+
+			for _, tt := range []struct {
+				name     string
+				writer   *CookieEncryptor
+				fallback bool
+				err      error
+			}{
+				{"current", rotated, false, nil},
+				{"fallback", NewCookieEncryptorWithOptions("old secret", WithCipher(m.mode)), true, nil},
+				{"unknown", NewCookieEncryptorWithOptions("unknown secret", WithCipher(m.mode)), false, ErrInvalidSignature},
+			} {
+				cookie := &http.Cookie{Name: "name", Value: "value"}
+				if err := tt.writer.Encrypt(cookie); err != nil {
+					t.Fatal(err)
+				}
+
+				fallback, err := rotated.decryptCookie(cookie, rotated.now())
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("decrypting a %s value returned %v, want %v", tt.name, err, tt.err)
+				}
+				if err == nil && (cookie.Value != "value" || fallback != tt.fallback) {
+					t.Errorf("decrypting a %s value returned %q, fallback %t, want %q, fallback %t", tt.name, cookie.Value, fallback, "value", tt.fallback)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackSecretsMarkCookiesForRewrite(t *testing.T) {
+	old := &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("old secret"), Encoder: JSONCookieEncoder{}}
+	rotated := &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("new secret", WithFallbackSecrets("old secret")), Encoder: JSONCookieEncoder{}}
+
+	for _, tt := range []struct {
+		name  string
+		cm    *SecureCookieManager
+		stale bool
+	}{
+		{"current", rotated, false},
+		{"fallback", old, true},
+	} {
+		stale, err := rotated.NeedsRewrite(setCookieRequest(t, tt.cm, "name", "value"), "name")
+		if err != nil || stale != tt.stale {
+			t.Errorf("%s cookie needs rewrite: %t, %v, want %t", tt.name, stale, err, tt.stale)
+		}
+	}
+}
+
+func TestCookieNameBinding(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithCookieNameBinding())
+
+	cookie := &http.Cookie{Name: "a", Value: "value"}
+	if err := ce.Encrypt(cookie); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := cookie.Value
+
+	if err := ce.Decrypt(&http.Cookie{Name: "b", Value: encrypted}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("decrypting a value encrypted for another name returned %v, want ErrInvalidSignature", err)
+	}
+
+	cookie = &http.Cookie{Name: "a", Value: encrypted}
+	if err := ce.Decrypt(cookie); err != nil || cookie.Value != "value" {
+		t.Errorf("decrypted %q, %v, want %q", cookie.Value, err, "value")
+	}
+
+	// Without binding the value is accepted under any name.
+	unbound := NewCookieEncryptorWithOptions("secret", WithCipher(GCM))
+	if err := unbound.Encrypt(cookie); err != nil {
+		t.Fatal(err)
+	}
+	if err := unbound.Decrypt(&http.Cookie{Name: "b", Value: cookie.Value}); err != nil {
+		t.Errorf("decrypting an unbound value under another name returned %v", err)
+	}
+}
+
+func TestCookieNameBindingRejectsRenamedCookies(t *testing.T) {
+	cm := &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithCookieNameBinding()), Encoder: JSONCookieEncoder{}}
+
+	a, _ := setCookieRequest(t, cm, "a", "value").Cookie("a")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "b", Value: a.Value})
+
+	var v string
+	if _, err := cm.Get(req, "b", &v); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("reading a cookie set as another name returned %q, %v, want ErrInvalidSignature", v, err)
+	}
+}
+
+func TestRotatingEncryptorGracePeriod(t *testing.T) {
+	rotatedAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := rotatedAt
+	ce := NewRotatingEncryptor("new secret", "old secret", rotatedAt, time.Hour, WithClock(ClockFunc(func() time.Time { return now })))
+
+	old, err := NewCookieEncryptorWithOptions("old secret").EncryptValue("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ce.EncryptValue("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = rotatedAt.Add(59 * time.Minute)
+	if got, err := ce.DecryptValue(old); err != nil || got != "old" {
+		t.Errorf("within the grace period decrypted %q, %v, want %q", got, err, "old")
+	}
+
+	now = rotatedAt.Add(time.Hour)
+	if _, err := ce.DecryptValue(old); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("after the grace period decrypting using the old secret returned %v, want ErrInvalidSignature", err)
+	}
+	if got, err := ce.DecryptValue(current); err != nil || got != "current" {
+		t.Errorf("after the grace period decrypted %q, %v, want %q", got, err, "current")
+	}
+}
+
+func TestDeterministicEncryption(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithDeterministicEncryption(), WithCookieNameBinding())
+	encrypt := func(name, value string) string {
+		t.Helper()
+
+		cookie := &http.Cookie{Name: name, Value: value}
+		if err := ce.Encrypt(cookie); err != nil {
+			t.Fatal(err)
+		}
+
+		return cookie.Value
+	}
+
+	msg := encrypt("a", "value")
+	if again := encrypt("a", "value"); again != msg {
+		t.Errorf("encrypting the same value twice returned %q and %q", msg, again)
+	}
+	if other := encrypt("b", "value"); other == msg {
+		t.Error("encrypting the same value for another name returned the same message")
+	}
+	if other := encrypt("a", "other value"); other == msg {
+		t.Error("encrypting another value returned the same message")
+	}
+
+	// Nonces are derived from the additional data as well as from the value.
+	a, err := ce.messageCipher.encrypt([]byte("value"), []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ce.messageCipher.encrypt([]byte("value"), []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("encrypting the same value using other additional data returned the same message")
+	}
+
+	cookie := &http.Cookie{Name: "a", Value: msg}
+	if err := ce.Decrypt(cookie); err != nil || cookie.Value != "value" {
+		t.Errorf("decrypted %q, %v, want %q", cookie.Value, err, "value")
+	}
+
+	// GCM encryptors not using deterministic encryption read the values as well.
+	random := NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithCookieNameBinding())
+	cookie = &http.Cookie{Name: "a", Value: msg}
+	if err := random.Decrypt(cookie); err != nil || cookie.Value != "value" {
+		t.Errorf("decrypted %q, %v without deterministic encryption, want %q", cookie.Value, err, "value")
+	}
+}
+
+func TestNewCookieEncryptorContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ce, err := NewCookieEncryptorContext(ctx, "cancelled secret", DefaultIterations)
+	if ce != nil || !errors.Is(err, context.Canceled) {
+		t.Errorf("returned %v, %v, want context.Canceled", ce, err)
+	}
+}
+
+func TestNewCookieEncryptorContextDeadline(t *testing.T) {
+	// Enough iterations for the derivation to outlast the deadline, using a secret whose keys aren't
+	// cached yet.
+	const iterations = 100000
+	secret := fmt.Sprintf("deadline secret %d", time.Now().UnixNano())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	ce, err := NewCookieEncryptorContext(ctx, secret, iterations)
+	if ce != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("returned %v, %v, want context.DeadlineExceeded", ce, err)
+	}
+
+	// The derivation carried on in the background: waiting for it must return the right keys.
+	ce = NewCookieEncryptorWithOptions(secret, WithIterations(iterations))
+	for _, key := range []struct {
+		salt string
+		size int
+	}{
+		{"encrypted cookie", 32},
+		{"signed encrypted cookie", 64},
+	} {
+		id := derivedKeyID{secret: secret, kdf: PBKDF2, iterations: iterations, salt: key.salt, size: key.size}
+		if got, want := deriveKey(secret, PBKDF2, iterations, key.salt, key.size), generateKey(id); !bytes.Equal(got, want) {
+			t.Errorf("cached %q key is %x, want %x", key.salt, got, want)
+		}
+	}
+
+	msg, err := ce.EncryptValue("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ce.DecryptValue(msg); err != nil || got != "value" {
+		t.Errorf("decrypted %q, %v, want %q", got, err, "value")
+	}
+}
+
+func TestURLSafeEncoding(t *testing.T) {
+	for _, mode := range []CipherMode{CBC, GCM, SignOnly} {
+		ce := NewCookieEncryptorWithOptions("secret", WithCipher(mode), WithURLSafeEncoding())
+		standard := NewCookieEncryptorWithOptions("secret", WithCipher(mode))
+
+		// Enough values for the standard encoding to need +, / and padding.
+		for i := 1; i < 32; i++ {
+			value := strings.Repeat("\xfb\xff", i)
+
+			msg, err := ce.EncryptValue(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.ContainsAny(msg, "+/=") {
+				t.Errorf("URL-safe value %q contains +, / or =", msg)
+			}
+			if got, err := ce.DecryptValue(msg); err != nil || got != value {
+				t.Errorf("decrypted %q, %v, want %q", got, err, value)
+			}
+
+			msg, err = standard.EncryptValue(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ce.DecryptValue(msg); !errors.Is(err, ErrDecryptFailed) {
+				t.Errorf("decrypting a standard base64 value returned %v, want ErrDecryptFailed", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrCookieMissing is returned when the requested cookie isn't present. It's the same value as
+	// http.ErrNoCookie so existing comparisons keep working.
+	ErrCookieMissing = http.ErrNoCookie
+
+	// ErrMalformedCookieHeader is returned when a raw Cookie header can't be parsed.
+	ErrMalformedCookieHeader = errors.New("malformed Cookie header")
+
+	// ErrInvalidSignature is returned when a cookie's signature or authentication tag doesn't verify,
+	// which usually means it was tampered with or signed using an unknown secret.
+	ErrInvalidSignature = errors.New("invalid cookie signature")
+
+	// ErrDecryptFailed is returned when a cookie can't be decrypted, for instance because it is
+	// malformed.
+	ErrDecryptFailed = errors.New("cookie decryption failed")
+
+	// ErrUnknownFormatVersion is returned when decrypting a value whose version header isn't known, for
+	// instance because it was written by a newer release.
+	ErrUnknownFormatVersion = errors.New("unknown cookie format version")
+
+	// ErrCookieExpired is returned when the expiration recorded inside an encrypted cookie has passed,
+	// meaning the client kept sending it past its lifetime.
+	ErrCookieExpired = errors.New("cookie expired")
+
+	// ErrDecodeFailed is returned when a decrypted cookie can't be decoded by the CookieEncoder.
+	ErrDecodeFailed = errors.New("cookie decoding failed")
+
+	// ErrCookieTooLarge is returned when the serialized cookie exceeds the manager's size limit. Browsers
+	// silently drop cookies above their limit, so it's better to fail loudly when writing them.
+	ErrCookieTooLarge = errors.New("cookie too large")
+
+	// ErrInvalidCookieName is returned when setting a cookie whose name isn't a valid RFC 6265
+	// cookie-name, for instance because it contains spaces or control characters.
+	ErrInvalidCookieName = errors.New("invalid cookie name")
+
+	// ErrInvalidCookieValue is returned when a serialized cookie value contains characters not allowed by
+	// RFC 6265.
+	ErrInvalidCookieValue = errors.New("invalid cookie value")
+
+	// ErrInvalidCookieAttribute is returned when setting a cookie with an attribute browsers wouldn't
+	// understand.
+	ErrInvalidCookieAttribute = errors.New("invalid cookie attribute")
+
+	// ErrInvalidMaxAge is returned when setting a cookie with a MaxAge that can't be represented in
+	// whole seconds, such as 500ms, instead of silently making it a browser-session cookie.
+	ErrInvalidMaxAge = errors.New("invalid cookie MaxAge")
+
+	// ErrInsecureSameSiteNone is returned when setting a cookie with SameSite=None but without Secure,
+	// which browsers reject.
+	ErrInsecureSameSiteNone = errors.New("cookie with SameSite=None must be Secure")
+
+	// ErrInvalidCookiePrefix is returned when setting a cookie whose name uses the __Secure- or __Host-
+	// prefix without the attributes browsers require for them.
+	ErrInvalidCookiePrefix = errors.New("cookie attributes don't satisfy its name prefix")
+
+	// ErrSessionExpired is returned when the expiration stored inside a session cookie has passed.
+	ErrSessionExpired = errors.New("session expired")
+
+	// ErrSessionNotFound is returned when a server-side session referenced by a cookie doesn't exist,
+	// for instance because it expired or was destroyed.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrCookieChunkMissing is returned when a cookie split across multiple chunks can't be reassembled
+	// because some of the chunks weren't sent.
+	ErrCookieChunkMissing = errors.New("cookie chunk missing")
+
+	// ErrInvalidCSRFToken is returned when the CSRF token submitted with a request doesn't match the one
+	// stored in its cookie.
+	ErrInvalidCSRFToken = errors.New("invalid CSRF token")
+
+	// ErrInsecureRequest is returned when reading a cookie from a request that didn't use HTTPS, with
+	// SecureCookieManager.SecureRequest set.
+	ErrInsecureRequest = errors.New("cookie received over an insecure request")
+
+	// ErrJSONRootMismatch is returned when decoding a JSON cookie whose root value, an object or an
+	// array, doesn't match the destination, for instance while migrating between schemas. It's wrapped
+	// by ErrDecodeFailed.
+	ErrJSONRootMismatch = errors.New("JSON root type mismatch")
+
+	// ErrDecodedTooLarge is returned when a compressed cookie inflates beyond the configured
+	// MaxDecodedSize, as decompression bombs do.
+	ErrDecodedTooLarge = errors.New("decoded cookie too large")
+
+	// ErrMessageTooLarge is returned when DecryptFrom reads a message exceeding the configured
+	// MaxStreamSize.
+	ErrMessageTooLarge = errors.New("encrypted message too large")
+)
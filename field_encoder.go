@@ -0,0 +1,117 @@
+package cookies
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// FieldEncryptingEncoder encodes structs as JSON like JSONCookieEncoder, but encrypts the fields
+// tagged with `cookie:"encrypt"` individually using Encryptor. Combined with a SignOnly encryptor on
+// the SecureCookieManager, this lets clients read fields such as an expiration while others, such as
+// a user ID, stay hidden. Only fields declared directly by the struct can be encrypted.
+type FieldEncryptingEncoder struct {
+	Encryptor *CookieEncryptor
+}
+
+func (e FieldEncryptingEncoder) Encode(v interface{}, c *http.Cookie) error {
+	fields, err := encryptedFields(v)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+
+	for _, name := range fields {
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+
+		msg, err := e.Encryptor.EncryptBytes(value)
+		if err != nil {
+			return err
+		}
+
+		if obj[name], err = json.Marshal(msg); err != nil {
+			return err
+		}
+	}
+
+	if b, err = json.Marshal(obj); err != nil {
+		return err
+	}
+
+	c.Value = string(b)
+	return nil
+}
+
+func (e FieldEncryptingEncoder) Decode(v interface{}, c *http.Cookie) error {
+	fields, err := encryptedFields(v)
+	if err != nil {
+		return err
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(c.Value), &obj); err != nil {
+		return err
+	}
+
+	for _, name := range fields {
+		value, ok := obj[name]
+		if !ok {
+			continue
+		}
+
+		var msg string
+		if err := json.Unmarshal(value, &msg); err != nil {
+			return fmt.Errorf("cookies: encrypted field %q isn't a string: %w", name, err)
+		}
+
+		if obj[name], err = e.Encryptor.DecryptBytes(msg); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// encryptedFields returns the JSON names of the fields of the struct v points to that are tagged to
+// be encrypted.
+func encryptedFields(v interface{}) ([]string, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cookies: FieldEncryptingEncoder requires a struct, got %T", v)
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("cookie") != "encrypt" {
+			continue
+		}
+
+		if name, ok := jsonFieldName(f); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,135 @@
+package cookies
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// FlashManager manages one-shot flash messages, such as "Profile saved", that are stored in a secure
+// cookie until they are consumed by the next request.
+type FlashManager struct {
+	cm   *SecureCookieManager
+	name string
+	opts *CookieOptions
+
+	// mu guards writers, the locks serializing changes to the flash cookie written to each response.
+	// Responses whose writers can't be map keys share uncomparable instead.
+	mu           sync.Mutex
+	writers      map[http.ResponseWriter]*writerLock
+	uncomparable sync.Mutex
+}
+
+type writerLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewFlashManager creates a new flash manager storing messages in the cookie name.
+func NewFlashManager(cm *SecureCookieManager, name string, opts *CookieOptions) *FlashManager {
+	return &FlashManager{cm: cm, name: name, opts: opts}
+}
+
+// Add adds msg under key to the flash messages written to w. Messages added to the same response
+// accumulate, including when Add is called concurrently.
+func (fm *FlashManager) Add(w http.ResponseWriter, key, msg string) error {
+	defer fm.lock(w)()
+
+	msgs := fm.pending(w)
+	msgs[key] = append(msgs[key], msg)
+
+	return fm.write(w, msgs)
+}
+
+// Consume returns the flash messages sent with req and clears them, re-issuing the cookie in w so
+// they don't show up again. Messages added to w before calling Consume are kept.
+func (fm *FlashManager) Consume(req *http.Request, w http.ResponseWriter) (map[string][]string, error) {
+	defer fm.lock(w)()
+
+	msgs := map[string][]string{}
+
+	_, err := fm.cm.Get(req, fm.name, &msgs)
+	if err == ErrCookieMissing {
+		return msgs, nil
+	}
+
+	if werr := fm.write(w, fm.pending(w)); werr != nil && err == nil {
+		err = werr
+	}
+
+	return msgs, err
+}
+
+// lock locks the flash cookie written to w, returning the function unlocking it. Only calls for the
+// same response wait for each other.
+func (fm *FlashManager) lock(w http.ResponseWriter) func() {
+	if !reflect.TypeOf(w).Comparable() {
+		fm.uncomparable.Lock()
+		return fm.uncomparable.Unlock
+	}
+
+	fm.mu.Lock()
+	if fm.writers == nil {
+		fm.writers = map[http.ResponseWriter]*writerLock{}
+	}
+	l, ok := fm.writers[w]
+	if !ok {
+		l = &writerLock{}
+		fm.writers[w] = l
+	}
+	l.refs++
+	fm.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		fm.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(fm.writers, w)
+		}
+		fm.mu.Unlock()
+	}
+}
+
+// pending returns the messages already written to w.
+func (fm *FlashManager) pending(w http.ResponseWriter) map[string][]string {
+	msgs := map[string][]string{}
+
+	lines := w.Header().Values("Set-Cookie")
+	for i := len(lines) - 1; i >= 0; i-- {
+		cookie, err := http.ParseSetCookie(lines[i])
+		if err != nil || cookie.Name != fm.name {
+			continue
+		}
+
+		if cookie.MaxAge < 0 || fm.cm.Encryptor.Decrypt(cookie) != nil || fm.cm.Encoder.Decode(&msgs, cookie) != nil {
+			return map[string][]string{}
+		}
+		break
+	}
+
+	return msgs
+}
+
+// write replaces the flash cookie written to w by one holding msgs, or by a deleting one when there
+// are no messages.
+func (fm *FlashManager) write(w http.ResponseWriter, msgs map[string][]string) error {
+	var lines []string
+	for _, line := range w.Header().Values("Set-Cookie") {
+		if cookie, err := http.ParseSetCookie(line); err == nil && cookie.Name == fm.name {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+	w.Header()["Set-Cookie"] = lines
+
+	if len(msgs) == 0 {
+		_, err := fm.cm.Delete(w, fm.name, fm.opts)
+		return err
+	}
+
+	_, err := fm.cm.Set(w, fm.name, fm.opts, msgs)
+	return err
+}
@@ -0,0 +1,40 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestFlashManagerConcurrentAdds(t *testing.T) {
+	fm := NewFlashManager(newTestManager(), "flash", nil)
+
+	recs := make([]*httptest.ResponseRecorder, 4)
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fm.Add(recs[i%len(recs)], "notice", fmt.Sprint(i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, rec := range recs {
+		msgs := fm.pending(rec)
+		if got := len(msgs["notice"]); got != 8 {
+			t.Errorf("response %d holds %d messages, want 8", i, got)
+		}
+	}
+
+	if len(fm.writers) != 0 {
+		t.Errorf("%d response locks left behind", len(fm.writers))
+	}
+}
@@ -0,0 +1,148 @@
+package cookies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fuzzEncryptors cover every cipher mode and message format.
+func fuzzEncryptors() []*CookieEncryptor {
+	return []*CookieEncryptor{
+		NewCookieEncryptorWithOptions("fuzz secret"),
+		NewCookieEncryptorWithOptions("fuzz secret", WithCipher(GCM)),
+		NewCookieEncryptorWithOptions("fuzz secret", WithCipher(SignOnly)),
+		NewCookieEncryptorWithOptions("fuzz secret", WithCipher(GCM), WithDeterministicEncryption()),
+		NewCookieEncryptorWithOptions("fuzz secret", WithKeySize(AES128), WithDigest(SHA256)),
+		NewCookieEncryptorWithOptions("fuzz secret", WithVersionedFormat(), WithURLSafeEncoding(), WithPadding(32)),
+		NewCookieEncryptorWithOptions("fuzz secret", WithCipher(GCM), WithVersionedFormat(), WithURLSafeEncoding()),
+		NewCookieEncryptorWithOptions("fuzz secret", WithSigningSecret("fuzz signing secret"),
+			WithFallbackEncryptionSecrets("fuzz old secret"), WithFallbackSigningSecrets("fuzz old secret")),
+	}
+}
+
+func FuzzDecrypt(f *testing.F) {
+	encryptors := fuzzEncryptors()
+
+	values := []string{"", "value", strings.Repeat("x", aes.BlockSize), `{"_rails":{"message":"InZhbHVlIg==","exp":null,"pur":"cookie.name"}}`}
+	for _, ce := range encryptors {
+		for _, value := range values {
+			msg, err := ce.EncryptValue(value)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(msg)
+		}
+	}
+	f.Add("--")
+	f.Add("$1")
+	f.Add("dmFsdWU=--")
+	f.Add("dmFsdWU=--dmFsdWU=--00")
+	f.Add("1700000000|1700000001|value")
+
+	f.Fuzz(func(t *testing.T, msg string) {
+		for _, ce := range encryptors {
+			value, err := ce.DecryptBytes(msg)
+			if err != nil {
+				continue
+			}
+
+			// Anything accepted must survive a round trip.
+			again, err := ce.EncryptBytes(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := ce.DecryptBytes(again); err != nil || !bytes.Equal(got, value) {
+				t.Fatalf("round trip of %q returned %q, %v", value, got, err)
+			}
+		}
+
+		if ciphertext, iv, err := parseCBCMessage([]byte(msg)); err == nil {
+			if len(iv) != aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+				t.Fatalf("parseCBCMessage accepted a %d byte IV and a %d byte ciphertext", len(iv), len(ciphertext))
+			}
+		}
+		if len(msg) > 0 && len(msg)%aes.BlockSize == 0 {
+			pkcs7Unpad([]byte(msg))
+		}
+		unpad([]byte(msg))
+		if value, ok := unpad(pad([]byte(msg), 32)); !ok || !bytes.Equal(value, []byte(msg)) {
+			t.Fatalf("unpad(pad(%q)) returned %q, %t", msg, value, ok)
+		}
+
+		unwrapRailsMetadata(&http.Cookie{Name: "name", Value: msg}, time.Now())
+		parseSessionTimestamps(msg)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Cookie", "name.0="+msg+"; name.1="+msg)
+		joinCookie(req, "name", 4)
+	})
+}
+
+type fuzzValue struct {
+	UnknownFields
+	UserID int      `json:"user_id"`
+	Name   string   `json:"name"`
+	Token  string   `json:"token" cookie:"encrypt"`
+	Tags   []string `json:"tags"`
+}
+
+func fuzzEncoders() []CookieEncoder {
+	return []CookieEncoder{
+		JSONCookieEncoder{},
+		JSONCookieEncoder{UseNumber: true, PreserveUnknownFields: true},
+		JSONCookieEncoder{DisallowUnknownFields: true},
+		RailsSessionEncoder{},
+		RailsSessionEncoder{UseNumber: true},
+		CompressingCookieEncoder{Encoder: JSONCookieEncoder{}},
+		ChainEncoder{Encoder: JSONCookieEncoder{}, Transforms: []Transform{GzipTransform{}, Base64Transform{}}},
+		FieldEncryptingEncoder{Encryptor: NewCookieEncryptorWithOptions("fuzz secret", WithCipher(GCM))},
+		&sessionEncoder{CookieEncoder: JSONCookieEncoder{}, IssuedAt: time.Unix(1700000000, 0), ExpiresAt: time.Unix(1700003600, 0)},
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	encoders := fuzzEncoders()
+
+	value := &fuzzValue{UserID: 42, Name: "name", Token: "token", Tags: []string{"a", "b"}}
+	for _, enc := range encoders {
+		c := &http.Cookie{Name: "name"}
+		if err := enc.Encode(value, c); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(c.Value)
+	}
+
+	form := &http.Cookie{Name: "name"}
+	if err := (FormCookieEncoder{}).Encode(url.Values{"a": {"1"}, "b": {"2", "3"}}, form); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(form.Value)
+
+	// UnknownFields has no exported fields, which gob rejects.
+	gob := &http.Cookie{Name: "name"}
+	if err := (GobCookieEncoder{}).Encode(map[string]interface{}{"user_id": 42, "tags": []string{"a"}}, gob); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(gob.Value)
+	f.Add(string(gzipMarker) + "\x1f\x8b")
+	f.Add("[1,2,3]")
+	f.Add(`{"userId":1e400}`)
+
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, enc := range encoders {
+			enc.Decode(new(fuzzValue), &http.Cookie{Name: "name", Value: s})
+			enc.Decode(new(map[string]interface{}), &http.Cookie{Name: "name", Value: s})
+		}
+
+		(FormCookieEncoder{}).Decode(new(url.Values), &http.Cookie{Name: "name", Value: s})
+		(FormCookieEncoder{}).Decode(new(map[string]string), &http.Cookie{Name: "name", Value: s})
+		(GobCookieEncoder{}).Decode(new(map[string]interface{}), &http.Cookie{Name: "name", Value: s})
+		(BinaryCookieEncoder{}).Decode(new(time.Time), &http.Cookie{Name: "name", Value: s})
+	})
+}
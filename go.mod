@@ -1,10 +1,16 @@
 module github.com/doximity/cookies
 
-go 1.22.6
+go 1.23.0
 
-require github.com/divoxx/goRailsYourself v0.0.0-20150818201947-3fe8d02f099f
+require (
+	github.com/divoxx/goRailsYourself v0.0.0-20150818201947-3fe8d02f099f
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/crypto v0.27.0
+	google.golang.org/protobuf v1.36.12
+)
 
 require (
 	github.com/franela/goblin v0.0.0-20211003143422-0a4f594942bf // indirect
-	golang.org/x/crypto v0.27.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
 )
@@ -0,0 +1,119 @@
+package cookies
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// UnknownFields can be embedded in structs decoded by a JSONCookieEncoder with PreserveUnknownFields
+// set to keep the JSON fields the struct doesn't declare, writing them back when the struct is encoded
+// again. This way, during a rolling deploy, older instances don't strip data written by newer ones.
+type UnknownFields struct {
+	fields map[string]json.RawMessage
+}
+
+func (u *UnknownFields) unknownFields() *UnknownFields {
+	return u
+}
+
+// unknownFieldsHolder is implemented by structs embedding UnknownFields.
+type unknownFieldsHolder interface {
+	unknownFields() *UnknownFields
+}
+
+// captureUnknownFields stores the fields of the JSON object data that v doesn't declare.
+func captureUnknownFields(v interface{}, data []byte) {
+	holder, ok := v.(unknownFieldsHolder)
+	if !ok {
+		return
+	}
+
+	u := holder.unknownFields()
+	u.fields = nil
+
+	var raw map[string]json.RawMessage
+	if json.Unmarshal(data, &raw) != nil {
+		return
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	for name, value := range raw {
+		if known[strings.ToLower(name)] {
+			continue
+		}
+
+		if u.fields == nil {
+			u.fields = map[string]json.RawMessage{}
+		}
+		u.fields[name] = value
+	}
+}
+
+// restoreUnknownFields adds the unknown fields captured in v to its JSON encoding data.
+func restoreUnknownFields(v interface{}, data []byte) ([]byte, error) {
+	holder, ok := v.(unknownFieldsHolder)
+	if !ok || len(holder.unknownFields().fields) == 0 {
+		return data, nil
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+
+	for name, value := range holder.unknownFields().fields {
+		if _, ok := obj[name]; !ok {
+			obj[name] = value
+		}
+	}
+
+	return json.Marshal(obj)
+}
+
+// jsonFieldNames returns the lowercased names of the JSON fields declared by the struct t points to,
+// including those promoted from embedded structs. Lowercasing matches encoding/json, which matches
+// field names case-insensitively.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if tag := f.Tag.Get("json"); f.Anonymous && tag != "-" && strings.Split(tag, ",")[0] == "" {
+			for embedded := range jsonFieldNames(f.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+
+		if name, ok := jsonFieldName(f); ok {
+			names[strings.ToLower(name)] = true
+		}
+	}
+
+	return names
+}
+
+// jsonFieldName returns the name encoding/json uses for the struct field f, or false if it's not
+// encoded.
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" || !f.IsExported() {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+
+	return name, true
+}
@@ -0,0 +1,196 @@
+package cookies
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+)
+
+// splitKeys reports whether c rotates signing and encryption secrets independently.
+func (c *encryptorConfig) splitKeys() bool {
+	return c.signingSecret != "" || len(c.fallbackSigningSecrets) > 0 || len(c.fallbackEncryptionSecrets) > 0
+}
+
+// newCiphers creates the ciphers for secret and the fallback secrets in c, the current one first.
+func newCiphers(secret string, c *encryptorConfig) []messageCipher {
+	var ciphers []messageCipher
+
+	switch {
+	case !c.splitKeys():
+		ciphers = append(ciphers, newMessageCipher(secret, c))
+	case c.mode == CBC:
+		ciphers = append(ciphers, newCBCKeyringCipher(secret, c))
+	case c.mode == GCM:
+		ciphers = append(ciphers, newMessageCipher(secret, c))
+		for _, fallbackSecret := range c.fallbackEncryptionSecrets {
+			ciphers = append(ciphers, newMessageCipher(fallbackSecret, c))
+		}
+	case c.mode == SignOnly:
+		ciphers = append(ciphers, newMessageCipher(c.currentSigningSecret(secret), c))
+		for _, fallbackSecret := range c.fallbackSigningSecrets {
+			ciphers = append(ciphers, newMessageCipher(fallbackSecret, c))
+		}
+	}
+
+	for _, fallbackSecret := range c.fallbackSecrets {
+		ciphers = append(ciphers, newMessageCipher(fallbackSecret, c))
+	}
+
+	return ciphers
+}
+
+func (c *encryptorConfig) currentSigningSecret(secret string) string {
+	if c.signingSecret == "" {
+		return secret
+	}
+
+	return c.signingSecret
+}
+
+// cbcKeyringCipher implements the aes-256-cbc encrypt-then-sign scheme with independently rotated
+// signing and encryption secrets. Messages are signed and encrypted using the current keys, and
+// verified and decrypted using any of the keys.
+type cbcKeyringCipher struct {
+	signers []*messageSigner
+	blocks  []cipher.Block
+	// ivTags compute the tags identifying the encryption keys, see ivTag.
+	ivTags []*macPool
+	// legacySigners verify messages using keys derived from the encryption secrets, the way messages
+	// with untagged IVs are signed.
+	legacySigners []*messageSigner
+}
+
+func newCBCKeyringCipher(secret string, c *encryptorConfig) *cbcKeyringCipher {
+	signingSecrets := append([]string{c.currentSigningSecret(secret)}, c.fallbackSigningSecrets...)
+	encryptionSecrets := append([]string{secret}, c.fallbackEncryptionSecrets...)
+
+	kc := &cbcKeyringCipher{}
+	for _, s := range signingSecrets {
+		signKey := deriveKey(s, c.kdf, c.iterations, saltOrDefault(c.salts.EncryptedSignedCookie, "signed encrypted cookie"), 64)
+		kc.signers = append(kc.signers, newMessageSigner(signKey, c.digest))
+	}
+	for _, s := range encryptionSecrets {
+		key := deriveKey(s, c.kdf, c.iterations, saltOrDefault(c.salts.EncryptedCookie, "encrypted cookie"), c.keySize.bytes())
+		kc.blocks = append(kc.blocks, newAESCipher(key))
+		kc.ivTags = append(kc.ivTags, newMACPool(key, sha256.New))
+
+		signKey := deriveKey(s, c.kdf, c.iterations, saltOrDefault(c.salts.EncryptedSignedCookie, "signed encrypted cookie"), 64)
+		kc.legacySigners = append(kc.legacySigners, newMessageSigner(signKey, c.digest))
+	}
+
+	return kc
+}
+
+// encrypt pads using PKCS#7, like Rails, and tags the IV so decrypt can tell which key it was encrypted
+// with.
+func (c *cbcKeyringCipher) encrypt(value []byte, additionalData []byte) (string, error) {
+	iv := make([]byte, ivTagOffset, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	iv = ivTag(c.ivTags[0], iv)
+
+	return c.signers[0].sign(sealCBC(nil, c.blocks[0], iv, pkcs7Pad(value))), nil
+}
+
+func (c *cbcKeyringCipher) decrypt(msg string, additionalData []byte) ([]byte, error) {
+	var (
+		encryptedMsg []byte
+		err          error
+	)
+	for _, signer := range c.signers {
+		if encryptedMsg, err = signer.verify(msg); err == nil {
+			break
+		}
+	}
+
+	if err == nil {
+		ciphertext, iv, err := parseCBCMessage(encryptedMsg)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, block := range c.blocks {
+			if hmac.Equal(iv, ivTag(c.ivTags[i], iv[:ivTagOffset:ivTagOffset])) {
+				plaintext := make([]byte, len(ciphertext))
+				cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+				if value, ok := pkcs7Unpad(plaintext); ok {
+					return value, nil
+				}
+				return nil, fmt.Errorf("%w: bad padding", ErrDecryptFailed)
+			}
+		}
+	}
+
+	// Messages encrypted elsewhere, such as by Rails or before the keys were split, have untagged IVs.
+	// They're signed using a key derived from the secret they were encrypted with, which identifies it.
+	for i, signer := range c.legacySigners {
+		legacyMsg, legacyErr := signer.verify(msg)
+		if legacyErr != nil {
+			continue
+		}
+
+		ciphertext, iv, err := parseCBCMessage(legacyMsg)
+		if err != nil {
+			return nil, err
+		}
+
+		// Decrypted the way cbcMessageCipher does, which doesn't pad values filling whole blocks.
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(c.blocks[i], iv).CryptBlocks(plaintext, ciphertext)
+
+		return unpadCBC(plaintext), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("%w: unknown encryption key", ErrDecryptFailed)
+}
+
+// ivTagOffset is where the tag identifying the encryption key starts in IVs generated by
+// cbcKeyringCipher, the bytes before it being random.
+const ivTagOffset = 8
+
+// ivTag completes the IV prefix, holding its random bytes, with the tag computed by tags.
+func ivTag(tags *macPool, prefix []byte) []byte {
+	return tags.appendSum(prefix, []byte("cookies iv tag"), prefix)[:aes.BlockSize]
+}
+
+// pkcs7Pad pads value to a whole number of blocks using PKCS#7, adding a full block when it already
+// fills whole blocks.
+func pkcs7Pad(value []byte) []byte {
+	n := aes.BlockSize - len(value)%aes.BlockSize
+
+	padded := make([]byte, len(value), len(value)+n)
+	copy(padded, value)
+	for i := 0; i < n; i++ {
+		padded = append(padded, byte(n))
+	}
+
+	return padded
+}
+
+// pkcs7Unpad strips the PKCS#7 padding from plaintext, reporting false if it isn't correctly padded.
+func pkcs7Unpad(plaintext []byte) ([]byte, bool) {
+	n := int(plaintext[len(plaintext)-1])
+	if n == 0 || n > aes.BlockSize || n > len(plaintext) {
+		return nil, false
+	}
+
+	valid := 1
+	for _, b := range plaintext[len(plaintext)-n:] {
+		valid &= subtle.ConstantTimeByteEq(b, byte(n))
+	}
+	if valid != 1 {
+		return nil, false
+	}
+
+	return plaintext[:len(plaintext)-n], true
+}
@@ -0,0 +1,65 @@
+package cookies
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyringReadsLegacyMessages(t *testing.T) {
+	legacy := NewCookieEncryptorWithOptions("old secret")
+	keyring := NewCookieEncryptorWithOptions("new secret", WithSigningSecret("signing secret"),
+		WithFallbackSigningSecrets("old secret"), WithFallbackEncryptionSecrets("old secret"))
+
+	for _, value := range []string{"short", strings.Repeat("x", 16), strings.Repeat("y", 33)} {
+		msg, err := legacy.EncryptValue(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := keyring.DecryptValue(msg)
+		if err != nil {
+			t.Fatalf("decrypting %d byte legacy value: %v", len(value), err)
+		}
+		if got != value {
+			t.Errorf("decrypted %q, want %q", got, value)
+		}
+	}
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("secret", WithSigningSecret("signing secret"),
+		WithFallbackEncryptionSecrets("old secret"))
+
+	for _, value := range []string{"", "short", strings.Repeat("x", 16), strings.Repeat("y", 33)} {
+		msg, err := ce.EncryptValue(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ce.DecryptValue(msg)
+		if err != nil {
+			t.Fatalf("decrypting %d byte value: %v", len(value), err)
+		}
+		if got != value {
+			t.Errorf("decrypted %q, want %q", got, value)
+		}
+	}
+}
+
+func TestKeyringRejectsUnknownEncryptionKey(t *testing.T) {
+	writer := NewCookieEncryptorWithOptions("other secret", WithSigningSecret("signing secret"))
+	reader := NewCookieEncryptorWithOptions("secret", WithSigningSecret("signing secret"),
+		WithFallbackEncryptionSecrets("old secret"))
+
+	for i := 0; i < 64; i++ {
+		msg, err := writer.EncryptValue("value")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := reader.DecryptValue(msg); !errors.Is(err, ErrDecryptFailed) {
+			t.Fatalf("decrypting using an unknown key returned %v, want ErrDecryptFailed", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cookies
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/divoxx/goRailsYourself/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeyDerivation selects the function used to derive keys from secrets.
+type KeyDerivation int
+
+const (
+	// PBKDF2 derives keys using PBKDF2-HMAC-SHA1 like Rails does before 7.0, or later versions keeping
+	// key_generator_hash_digest_class set to SHA1.
+	PBKDF2 KeyDerivation = iota
+	// Scrypt derives keys using scrypt with N=32768, r=8 and p=1. It isn't compatible with Rails.
+	Scrypt
+	// Argon2id derives keys using Argon2id with 1 pass over 64 MiB using 4 threads. It isn't compatible
+	// with Rails.
+	Argon2id
+	// PBKDF2SHA256 derives keys using PBKDF2-HMAC-SHA256 like Rails does since 7.0, through the
+	// key_generator_hash_digest_class default.
+	PBKDF2SHA256
+)
+
+type derivedKeyID struct {
+	secret     string
+	kdf        KeyDerivation
+	iterations int
+	salt       string
+	size       int
+}
+
+// derivedKeys caches keys derived by deriveKey across CookieEncryptor instances, since deriving them is
+// purposely expensive. The lock only guards the map, each key being derived once by its entry.
+var derivedKeys = struct {
+	sync.Mutex
+	keys map[derivedKeyID]*derivedKey
+}{keys: map[derivedKeyID]*derivedKey{}}
+
+type derivedKey struct {
+	once sync.Once
+	key  []byte
+}
+
+// deriveKey derives a key of the given size from secret and salt, reusing previously derived keys. The
+// iterations only apply to PBKDF2 and PBKDF2SHA256. The returned key is shared and must not be modified. Concurrent
+// calls for the same key wait for a single derivation, other keys are derived in parallel.
+func deriveKey(secret string, kdf KeyDerivation, iterations int, salt string, size int) []byte {
+	switch {
+	case kdf != PBKDF2 && kdf != PBKDF2SHA256:
+		iterations = 0
+	case iterations == 0:
+		iterations = DefaultIterations
+	}
+
+	id := derivedKeyID{secret, kdf, iterations, salt, size}
+
+	derivedKeys.Lock()
+	entry, ok := derivedKeys.keys[id]
+	if !ok {
+		entry = &derivedKey{}
+		derivedKeys.keys[id] = entry
+	}
+	derivedKeys.Unlock()
+
+	entry.once.Do(func() {
+		entry.key = generateKey(id)
+	})
+
+	return entry.key
+}
+
+// generateKey derives the key identified by id.
+func generateKey(id derivedKeyID) []byte {
+	switch id.kdf {
+	case PBKDF2:
+		kg := crypto.KeyGenerator{Secret: id.secret, Iterations: id.iterations}
+		return kg.Generate([]byte(id.salt), id.size)
+	case PBKDF2SHA256:
+		return pbkdf2.Key([]byte(id.secret), []byte(id.salt), id.iterations, id.size, sha256.New)
+	case Scrypt:
+		// scrypt only fails when given invalid parameters, which are fixed.
+		key, err := scrypt.Key([]byte(id.secret), []byte(id.salt), 1<<15, 8, 1, id.size)
+		if err != nil {
+			panic(err)
+		}
+
+		return key
+	case Argon2id:
+		return argon2.IDKey([]byte(id.secret), []byte(id.salt), 1, 64*1024, 4, uint32(id.size))
+	default:
+		panic(fmt.Sprintf("cookies: unsupported key derivation %d", id.kdf))
+	}
+}
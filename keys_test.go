@@ -0,0 +1,51 @@
+package cookies
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// The PBKDF2, PBKDF2SHA256 and scrypt vectors were computed using Python's hashlib, the Argon2id ones using
+// golang.org/x/crypto/argon2, which reproduces the reference implementation's own vectors. Any change
+// to these outputs would make existing cookies unreadable.
+var keyDerivationVectors = []struct {
+	kdf  KeyDerivation
+	salt string
+	size int
+	key  string
+}{
+	{PBKDF2, "encrypted cookie", 32, "905b9c860777225ef746d3edb12252ee8e90f72c4249ca530d165b174fafa75b"},
+	{PBKDF2, "signed encrypted cookie", 64, "dae8077601fa8beeed53d5bbb4fee4ad6cdc7e4aa8911f4950d54d1579febd7f1fbb99cdb2c0a9808e45bc4f013f00c1edac5eaa26b24e61dd91487e3c25d156"},
+	{PBKDF2SHA256, "encrypted cookie", 32, "2bd0df1fd90584b430c632a071f10421254389c3d9a1c9d8ca3a66e96ec8a435"},
+	{PBKDF2SHA256, "signed encrypted cookie", 64, "bbffc8f7569f73c91dbeed91ae088d94fc8e98c3890c70bb46573859e5c45550f2aeb96ab4430dd7850227baa19e71a0bf0b6085feba304fa78a403ccb890f90"},
+	{Scrypt, "encrypted cookie", 32, "ce9c43474647bb16c58375a6327ee186ea7a7a89f5d6fd93fc7a222071084a20"},
+	{Scrypt, "signed encrypted cookie", 64, "0f09781aff151749e47cfd50f9ff5eac664948e7f06b769098a21f74383516ee7900effd5bf3e9fedb671501d148bf5df0414fcd1912267ba56def48c5a6b0e4"},
+	{Argon2id, "encrypted cookie", 32, "f5d04f7bb0553bbe842010ebd07eaa636785565be56e53bddf125a3f6d798d16"},
+	{Argon2id, "signed encrypted cookie", 64, "5fdd0cf848029c6b371bcd8b1fafef4390de6af8d6d53a452dd65628043b6ad5d83665dbf4e367411d0bcfa5fc4b79bed27557455e63b92ae1f8d48eb321fc0a"},
+}
+
+func TestDeriveKeyVectors(t *testing.T) {
+	for _, v := range keyDerivationVectors {
+		if got := hex.EncodeToString(deriveKey("secret", v.kdf, DefaultIterations, v.salt, v.size)); got != v.key {
+			t.Errorf("deriveKey(%d, %q, %d) = %s, want %s", v.kdf, v.salt, v.size, got, v.key)
+		}
+	}
+}
+
+func TestDeriveKeyConcurrently(t *testing.T) {
+	const n = 8
+
+	keys := make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			keys <- deriveKey("concurrent secret", PBKDF2, 20000, "concurrent salt", 32)
+		}()
+	}
+
+	first := <-keys
+	for i := 1; i < n; i++ {
+		if key := <-keys; &key[0] != &first[0] {
+			t.Fatal("concurrent calls derived the key more than once")
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// log emits a structured event using Logger, if set.
+func (cm *SecureCookieManager) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if cm.Logger == nil {
+		return
+	}
+
+	cm.Logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// requestContext returns the context of req, or the background context for callers passing no
+// request.
+func requestContext(req *http.Request) context.Context {
+	if req == nil {
+		return context.Background()
+	}
+
+	return req.Context()
+}
+
+// logDecryptError logs a cookie sent with the request that failed to decrypt. Expired cookies are
+// expected and logged at a lower level than other failures, such as tampered ones.
+func (cm *SecureCookieManager) logDecryptError(ctx context.Context, name string, err error) {
+	level, msg := slog.LevelWarn, "cookie decryption failed"
+	switch {
+	case errors.Is(err, ErrCookieExpired):
+		level, msg = slog.LevelInfo, "cookie expired"
+	case errors.Is(err, ErrInsecureRequest):
+		msg = "cookie received over an insecure request"
+	}
+
+	cm.log(ctx, level, msg,
+		slog.String("cookie", name),
+		slog.String("reason", decryptFailureReason(err)),
+		slog.String("error", err.Error()),
+	)
+}
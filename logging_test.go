@@ -0,0 +1,74 @@
+package cookies
+
+import (
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logContextKey struct{}
+
+// contextHandler is a slog.Handler recording the value held under logContextKey by the context of
+// each record.
+type contextHandler struct {
+	mu     sync.Mutex
+	values map[string][]interface{}
+}
+
+func (h *contextHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.values[r.Message] = append(h.values[r.Message], ctx.Value(logContextKey{}))
+	return nil
+}
+
+func (h *contextHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *contextHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestLoggerReceivesRequestContext(t *testing.T) {
+	h := &contextHandler{values: map[string][]interface{}{}}
+	cm := newTestManager()
+	cm.Logger = slog.New(h)
+
+	ctx := context.WithValue(context.Background(), logContextKey{}, "trace")
+
+	rec := httptest.NewRecorder()
+	if _, err := cm.SetContext(ctx, rec, "name", nil, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.SetManyContext(ctx, rec, []CookieWrite{{Name: "other", Value: "value"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := requestWithCookies(rec).WithContext(ctx)
+	if _, err := cm.Touch(httptest.NewRecorder(), req, "name", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewCookieSessionManager(cm, "session", nil)
+	sm.ExpiresIn = time.Hour
+	if err := sm.Update(httptest.NewRecorder(), req, &testSession{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Cookie", "name=tampered")
+	var v string
+	cm.Get(req, "name", &v)
+
+	for msg, n := range map[string]int{"cookie set": 4, "cookie decryption failed": 1} {
+		if len(h.values[msg]) != n {
+			t.Errorf("logged %q %d times, want %d", msg, len(h.values[msg]), n)
+		}
+		for _, v := range h.values[msg] {
+			if v != "trace" {
+				t.Errorf("logged %q using a context holding %v, want the request context", msg, v)
+			}
+		}
+	}
+}
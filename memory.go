@@ -0,0 +1,97 @@
+package cookies
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemorySessionManager manages sessions by keeping their data in memory under a random ID, keeping
+// only the encrypted ID in the cookie. It's meant for development and tests since sessions are lost on
+// restart and aren't shared across processes. It's safe for concurrent use.
+type MemorySessionManager struct {
+	serverSessions
+
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	// sweepAt is when set next prunes every expired session, see set.
+	sweepAt time.Time
+
+	// TTL is how long sessions are kept after their last update. Expired sessions are pruned lazily,
+	// when read or at most once per TTL when writing. Zero keeps them until they're destroyed.
+	TTL time.Duration
+}
+
+type memorySession struct {
+	data      string
+	expiresAt time.Time
+}
+
+// NewMemorySessionManager creates a new in-memory session manager. The cookie holding the session ID
+// is written by cm, whose Encoder is also used to serialize sessions and whose Clock is used to expire
+// them.
+func NewMemorySessionManager(cm *SecureCookieManager, name string, opts *CookieOptions) *MemorySessionManager {
+	sm := &MemorySessionManager{sessions: map[string]memorySession{}}
+	sm.serverSessions = serverSessions{store: memoryStore{sm}, cm: cm, name: name, opts: opts}
+
+	return sm
+}
+
+// memoryStore implements sessionStore on top of a MemorySessionManager's map.
+type memoryStore struct {
+	sm *MemorySessionManager
+}
+
+func (s memoryStore) get(ctx context.Context, id string) (string, error) {
+	s.sm.mu.Lock()
+	defer s.sm.mu.Unlock()
+
+	sess, ok := s.sm.sessions[id]
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+
+	if s.sm.expired(sess) {
+		delete(s.sm.sessions, id)
+		return "", ErrSessionNotFound
+	}
+
+	return sess.data, nil
+}
+
+func (s memoryStore) set(ctx context.Context, id string, data string) error {
+	s.sm.mu.Lock()
+	defer s.sm.mu.Unlock()
+
+	sess := memorySession{data: data}
+	if s.sm.TTL > 0 {
+		now := s.sm.cm.now()
+		sess.expiresAt = now.Add(s.sm.TTL)
+
+		// Sweeping once per TTL keeps writes cheap while bounding how long unread expired sessions
+		// are kept.
+		if !now.Before(s.sm.sweepAt) {
+			for id, sess := range s.sm.sessions {
+				if s.sm.expired(sess) {
+					delete(s.sm.sessions, id)
+				}
+			}
+			s.sm.sweepAt = now.Add(s.sm.TTL)
+		}
+	}
+
+	s.sm.sessions[id] = sess
+	return nil
+}
+
+func (s memoryStore) del(ctx context.Context, id string) error {
+	s.sm.mu.Lock()
+	defer s.sm.mu.Unlock()
+
+	delete(s.sm.sessions, id)
+	return nil
+}
+
+func (sm *MemorySessionManager) expired(sess memorySession) bool {
+	return !sess.expiresAt.IsZero() && !sm.cm.now().Before(sess.expiresAt)
+}
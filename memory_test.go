@@ -0,0 +1,49 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorePrunesExpiredSessions(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cm := newTestManager()
+	cm.Clock = ClockFunc(func() time.Time { return now })
+
+	sm := NewMemorySessionManager(cm, "session", nil)
+	sm.TTL = time.Hour
+	store := memoryStore{sm}
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.set(ctx, id, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(90 * time.Minute)
+	if _, err := store.get(ctx, "a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("reading an expired session returned %v, want ErrSessionNotFound", err)
+	}
+	if len(sm.sessions) != 2 {
+		t.Errorf("reading an expired session kept %d sessions, want 2", len(sm.sessions))
+	}
+
+	if err := store.set(ctx, "d", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.sessions) != 1 {
+		t.Errorf("sweeping kept %d sessions, want 1", len(sm.sessions))
+	}
+
+	// Writes within the TTL of the last sweep don't scan the sessions.
+	now = now.Add(30 * time.Minute)
+	if err := store.set(ctx, "e", "e"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sm.sessions) != 2 {
+		t.Errorf("writing before the next sweep kept %d sessions, want 2", len(sm.sessions))
+	}
+}
@@ -0,0 +1,54 @@
+package cookies
+
+import (
+	"errors"
+	"time"
+)
+
+// Metrics collects measurements from a SecureCookieManager, for instance to export them to
+// Prometheus. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveEncrypt is called with the time spent encrypting each cookie written.
+	ObserveEncrypt(d time.Duration)
+	// IncDecryptFailure is called whenever a cookie sent by the client fails to decrypt, with the
+	// reason it failed, one of the DecryptFailure constants.
+	IncDecryptFailure(reason string)
+	// ObserveCookieSize is called with the size of the serialized Set-Cookie header of each cookie
+	// written, before any splitting into chunks.
+	ObserveCookieSize(n int)
+}
+
+// Reasons passed to Metrics.IncDecryptFailure.
+const (
+	DecryptFailureSignature     = "signature"
+	DecryptFailureDecrypt       = "decrypt"
+	DecryptFailureFormatVersion = "format_version"
+	DecryptFailureExpired       = "expired"
+	DecryptFailureInsecure      = "insecure_request"
+	DecryptFailureOther         = "other"
+)
+
+// decryptFailureReason classifies a decryption error for Metrics.IncDecryptFailure.
+func decryptFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidSignature):
+		return DecryptFailureSignature
+	case errors.Is(err, ErrDecryptFailed):
+		return DecryptFailureDecrypt
+	case errors.Is(err, ErrUnknownFormatVersion):
+		return DecryptFailureFormatVersion
+	case errors.Is(err, ErrCookieExpired):
+		return DecryptFailureExpired
+	case errors.Is(err, ErrInsecureRequest):
+		return DecryptFailureInsecure
+	default:
+		return DecryptFailureOther
+	}
+}
+
+// noopMetrics is the Metrics used when SecureCookieManager.Metrics is not set.
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveEncrypt(time.Duration) {}
+func (noopMetrics) IncDecryptFailure(string)     {}
+func (noopMetrics) ObserveCookieSize(int)        {}
@@ -0,0 +1,57 @@
+package cookies
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingMetrics counts the calls to each Metrics method.
+type countingMetrics struct {
+	mu                            sync.Mutex
+	encrypts, failures, sizeCalls int
+}
+
+func (m *countingMetrics) ObserveEncrypt(time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encrypts++
+}
+
+func (m *countingMetrics) IncDecryptFailure(string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+}
+
+func (m *countingMetrics) ObserveCookieSize(int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sizeCalls++
+}
+
+func TestEstimateSizeSkipsMetrics(t *testing.T) {
+	metrics := &countingMetrics{}
+	cm := newTestManager()
+	cm.Metrics = metrics
+
+	estimate, err := cm.EstimateSize("name", &CookieOptions{}, "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.encrypts != 0 || metrics.sizeCalls != 0 {
+		t.Errorf("EstimateSize recorded %d encryptions and %d sizes", metrics.encrypts, metrics.sizeCalls)
+	}
+
+	rec := httptest.NewRecorder()
+	if _, err := cm.Set(rec, "name", &CookieOptions{}, "value"); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.encrypts != 1 {
+		t.Errorf("Set recorded %d encryptions, want 1", metrics.encrypts)
+	}
+	if got := len(rec.Header().Get("Set-Cookie")); got != estimate {
+		t.Errorf("EstimateSize returned %d, Set wrote %d bytes", estimate, got)
+	}
+}
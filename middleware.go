@@ -0,0 +1,51 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+)
+
+type sessionContextKey struct{}
+
+// SessionMiddleware returns a middleware loading the current session from sm into the request context,
+// where handlers can read it using SessionFromContext. Sessions are created using newSession, and when
+// the request has no usable session, because it's missing, expired or tampered, a fresh one is used
+// instead. Other errors, including those returned by Validate unless they wrap ErrSessionExpired,
+// fail the request with a 500.
+func SessionMiddleware(sm SessionManager, newSession SessionConstructor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			sess, err := newSession(req)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			if err := sm.Current(req, sess); err != nil {
+				if !startsNewSession(err) {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+
+				// Current may have partially decoded the session, so start over from a fresh one.
+				if sess, err = newSession(req); err != nil {
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, req.WithContext(ContextWithSession(req.Context(), sess)))
+		})
+	}
+}
+
+// ContextWithSession returns a copy of ctx holding sess.
+func ContextWithSession(ctx context.Context, sess Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sess)
+}
+
+// SessionFromContext returns the session stored in ctx by SessionMiddleware, if any.
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	sess, ok := ctx.Value(sessionContextKey{}).(Session)
+	return sess, ok
+}
@@ -0,0 +1,43 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// errSessions is a SessionManager whose Current always fails with err.
+type errSessions struct {
+	err error
+}
+
+func (sm errSessions) Current(*http.Request, Session) error                     { return sm.err }
+func (sm errSessions) Update(http.ResponseWriter, *http.Request, Session) error { return nil }
+
+func TestSessionMiddlewareErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{nil, http.StatusOK},
+		{ErrCookieMissing, http.StatusOK},
+		{ErrInvalidSignature, http.StatusOK},
+		{ErrSessionExpired, http.StatusOK},
+		{ErrSessionNotFound, http.StatusOK},
+		{errors.New("store unavailable"), http.StatusInternalServerError},
+	} {
+		newSession := func(*http.Request) (Session, error) { return &testSession{}, nil }
+		handler := SessionMiddleware(errSessions{tc.err}, newSession)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if _, ok := SessionFromContext(req.Context()); !ok {
+				t.Error("no session in the request context")
+			}
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != tc.status {
+			t.Errorf("Current returning %v: status %d, want %d", tc.err, rec.Code, tc.status)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package msgpackcookie
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+type fuzzValue struct {
+	UserID int               `msgpack:"user_id"`
+	Tags   []string          `msgpack:"tags"`
+	Attrs  map[string]string `msgpack:"attrs"`
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, v := range []interface{}{
+		&fuzzValue{UserID: 42, Tags: []string{"a", "b"}, Attrs: map[string]string{"k": "v"}},
+		map[string]interface{}{"user_id": 42, "nested": []interface{}{1, "two", 3.0}},
+		[]interface{}{nil, true, "x"},
+	} {
+		c := &http.Cookie{Name: "name"}
+		if err := (CookieEncoder{}).Encode(v, c); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(c.Value)
+	}
+	// An array claiming 2^32-1 elements.
+	f.Add(base64.StdEncoding.EncodeToString([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}))
+
+	f.Fuzz(func(t *testing.T, s string) {
+		(CookieEncoder{}).Decode(new(fuzzValue), &http.Cookie{Name: "name", Value: s})
+		(CookieEncoder{}).Decode(new(interface{}), &http.Cookie{Name: "name", Value: s})
+	})
+}
@@ -0,0 +1,103 @@
+package cookies
+
+import (
+	"net/http"
+	"time"
+)
+
+// SecureDefaults returns options suitable for most cookies: HttpOnly, Secure, SameSite=Lax and
+// scoped to the whole site. Callers may override fields on the returned value.
+func SecureDefaults() *CookieOptions {
+	return &CookieOptions{
+		Path:     "/",
+		HTTPOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// DefaultSessionOptions returns the SecureDefaults for session cookies. Neither MaxAge nor Expires
+// are set, so the cookie lasts until the browser is closed unless the caller sets them.
+func DefaultSessionOptions() *CookieOptions {
+	return SecureDefaults()
+}
+
+// CookieOptionsBuilder builds CookieOptions fluently:
+//
+//	opts := NewCookieOptions().WithPath("/").WithMaxAge(time.Hour).SameSite(http.SameSiteLaxMode).Build()
+type CookieOptionsBuilder struct {
+	opts CookieOptions
+}
+
+// NewCookieOptions creates a builder for options that are HttpOnly and Secure unless told otherwise.
+func NewCookieOptions() *CookieOptionsBuilder {
+	return &CookieOptionsBuilder{opts: CookieOptions{HTTPOnly: true, Secure: true}}
+}
+
+// NewCookieOptionsFrom creates a builder starting from a copy of opts, which may be nil.
+func NewCookieOptionsFrom(opts *CookieOptions) *CookieOptionsBuilder {
+	b := &CookieOptionsBuilder{}
+	if opts != nil {
+		b.opts = *opts
+	}
+
+	return b
+}
+
+func (b *CookieOptionsBuilder) WithDomain(domain string) *CookieOptionsBuilder {
+	b.opts.Domain = domain
+	return b
+}
+
+func (b *CookieOptionsBuilder) WithPath(path string) *CookieOptionsBuilder {
+	b.opts.Path = path
+	return b
+}
+
+func (b *CookieOptionsBuilder) WithMaxAge(d time.Duration) *CookieOptionsBuilder {
+	b.opts.MaxAge = d
+	return b
+}
+
+func (b *CookieOptionsBuilder) WithExpires(t time.Time) *CookieOptionsBuilder {
+	b.opts.Expires = t
+	return b
+}
+
+func (b *CookieOptionsBuilder) Secure() *CookieOptionsBuilder {
+	b.opts.Secure = true
+	return b
+}
+
+// Insecure allows sending the cookie over plain HTTP, for instance in local development.
+func (b *CookieOptionsBuilder) Insecure() *CookieOptionsBuilder {
+	b.opts.Secure = false
+	return b
+}
+
+func (b *CookieOptionsBuilder) HTTPOnly() *CookieOptionsBuilder {
+	b.opts.HTTPOnly = true
+	return b
+}
+
+// ScriptAccessible lets JavaScript read the cookie, which HTTPOnly prevents.
+func (b *CookieOptionsBuilder) ScriptAccessible() *CookieOptionsBuilder {
+	b.opts.HTTPOnly = false
+	return b
+}
+
+func (b *CookieOptionsBuilder) SameSite(s http.SameSite) *CookieOptionsBuilder {
+	b.opts.SameSite = s
+	return b
+}
+
+func (b *CookieOptionsBuilder) Partitioned() *CookieOptionsBuilder {
+	b.opts.Partitioned = true
+	return b
+}
+
+// Build returns the options. Later changes to the builder don't affect them.
+func (b *CookieOptionsBuilder) Build() *CookieOptions {
+	opts := b.opts
+	return &opts
+}
@@ -0,0 +1,29 @@
+package cookies
+
+import "bytes"
+
+// pad pads value to a multiple of blockSize bytes using ISO/IEC 7816-4 padding: a 0x80 byte followed
+// by as many zero bytes as needed. At least one byte is always added so the padding can be removed.
+// The padding is encrypted along with the value, so it can't be altered without failing
+// authentication.
+func pad(value []byte, blockSize int) []byte {
+	n := blockSize - len(value)%blockSize
+
+	padded := make([]byte, len(value)+n)
+	copy(padded, value)
+	padded[len(value)] = 0x80
+
+	return padded
+}
+
+// unpad removes the padding added by pad, reporting false if value isn't padded. It must only be
+// called by encryptors padding their values: unpadded values, such as gzip output, may end in a 0x80
+// byte followed by zeros too.
+func unpad(value []byte) ([]byte, bool) {
+	trimmed := bytes.TrimRight(value, "\x00")
+	if len(trimmed) == 0 || trimmed[len(trimmed)-1] != 0x80 {
+		return nil, false
+	}
+
+	return trimmed[:len(trimmed)-1], true
+}
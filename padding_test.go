@@ -0,0 +1,99 @@
+package cookies
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPaddingPreservesValuesEndingLikePadding(t *testing.T) {
+	// gzip output ends with the length of the input, here 128 bytes.
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(bytes.Repeat([]byte("a"), 128))
+	w.Close()
+	compressed := buf.Bytes()
+	if !bytes.HasSuffix(compressed, []byte{0x80, 0, 0, 0}) {
+		t.Fatalf("gzip output ends with %x", compressed[len(compressed)-4:])
+	}
+
+	for _, ce := range []*CookieEncryptor{
+		NewCookieEncryptorWithOptions("secret", WithVersionedFormat()),
+		NewCookieEncryptorWithOptions("secret", WithVersionedFormat(), WithPadding(64)),
+	} {
+		msg, err := ce.EncryptBytes(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := ce.DecryptBytes(msg); err != nil || !bytes.Equal(got, compressed) {
+			t.Errorf("decrypted %x, %v, want %x", got, err, compressed)
+		}
+	}
+}
+
+func TestPaddingHidesLength(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithPadding(64))
+
+	short, err := ce.EncryptValue("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := ce.EncryptValue("a much longer value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(short) != len(long) {
+		t.Errorf("encrypted values are %d and %d bytes long, want equal lengths", len(short), len(long))
+	}
+}
+
+func TestPaddingCantBeAddedToUnpaddedValues(t *testing.T) {
+	writer := NewCookieEncryptorWithOptions("secret", WithCipher(GCM))
+	readers := []*CookieEncryptor{writer, NewCookieEncryptorWithOptions("secret", WithCipher(GCM), WithPadding(64))}
+
+	value := "payload\x80\x00\x00"
+	msg, err := writer.EncryptValue(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reader := range readers {
+		if got, err := reader.DecryptValue("!" + msg); err == nil {
+			t.Errorf("decrypting a message prefixed by ! returned %q", got)
+		}
+	}
+
+	if got, err := writer.DecryptValue(msg); err != nil || got != value {
+		t.Errorf("decrypted %q, %v, want %q", got, err, value)
+	}
+}
+
+func TestPaddingRejectsUnpaddedValues(t *testing.T) {
+	unpadded := NewCookieEncryptorWithOptions("secret")
+	padded := NewCookieEncryptorWithOptions("secret", WithPadding(64))
+
+	msg, err := unpadded.EncryptValue(`"value"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := padded.DecryptValue(msg); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("decrypting an unpadded value returned %v, want ErrDecryptFailed", err)
+	}
+
+	// Listing an encryptor without padding as fallback reads values written before enabling padding.
+	cm := &SecureCookieManager{Encryptor: padded, FallbackEncryptors: []*CookieEncryptor{unpadded}, Encoder: JSONCookieEncoder{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "name", Value: msg})
+
+	var got string
+	if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+		t.Errorf("got %q, %v, want %q", got, err, "value")
+	}
+}
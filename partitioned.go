@@ -0,0 +1,34 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+)
+
+// UnpartitionedSuffix is appended to the name of the unpartitioned copies of cookies written when
+// SecureCookieManager.PartitionedFallback is enabled.
+const UnpartitionedSuffix = ".unpartitioned"
+
+func unpartitionedName(name string) string {
+	return name + UnpartitionedSuffix
+}
+
+// writeUnpartitioned writes a copy of the not yet encrypted cookie without the Partitioned attribute.
+func (cm *SecureCookieManager) writeUnpartitioned(ctx context.Context, w http.ResponseWriter, cookie *http.Cookie, opts *CookieOptions) error {
+	fallback := *cookie
+	fallback.Name = unpartitionedName(cookie.Name)
+	fallback.Partitioned = false
+
+	return cm.write(ctx, w, &fallback, opts.unpartitioned())
+}
+
+// unpartitioned returns a copy of the options without Partitioned.
+func (opts *CookieOptions) unpartitioned() *CookieOptions {
+	if opts == nil {
+		return nil
+	}
+
+	unpartitioned := *opts
+	unpartitioned.Partitioned = false
+	return &unpartitioned
+}
@@ -0,0 +1,60 @@
+package cookies
+
+import (
+	"crypto/hmac"
+	"hash"
+	"sync"
+)
+
+// maxPooledBufferSize bounds the buffers returned to bufferPool, so encrypting an unusually large
+// value once doesn't keep its buffers alive.
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool holds the scratch buffers messages are built in, since every cookie read or written
+// needs a few of them.
+var bufferPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer returns buf to the pool, storing b, which is usually buf grown, in it.
+func putBuffer(buf *[]byte, b []byte) {
+	if cap(b) > maxPooledBufferSize {
+		return
+	}
+
+	*buf = b[:0]
+	bufferPool.Put(buf)
+}
+
+// macPool reuses the HMACs keyed with a single key, since creating one allocates its hashes and pads.
+type macPool struct {
+	pool sync.Pool
+}
+
+type pooledMAC struct {
+	hash.Hash
+	sum []byte
+}
+
+func newMACPool(key []byte, hasher func() hash.Hash) *macPool {
+	p := &macPool{}
+	p.pool.New = func() interface{} { return &pooledMAC{Hash: hmac.New(hasher, key)} }
+
+	return p
+}
+
+// appendSum appends the HMAC of the concatenated parts to dst.
+func (p *macPool) appendSum(dst []byte, parts ...[]byte) []byte {
+	mac := p.pool.Get().(*pooledMAC)
+	defer p.pool.Put(mac)
+
+	mac.Reset()
+	for _, part := range parts {
+		mac.Write(part)
+	}
+
+	mac.sum = mac.Sum(mac.sum[:0])
+	return append(dst, mac.sum...)
+}
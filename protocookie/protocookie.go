@@ -0,0 +1,46 @@
+// Package protocookie provides a cookies.CookieEncoder using Protocol Buffers, allowing cookies to
+// reuse message schemas shared with other services. It lives in its own package so only users that
+// need it depend on the protobuf library.
+package protocookie
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// CookieEncoder encodes/decodes cookies using Protocol Buffers. Values must implement proto.Message
+// (usually a pointer to a generated message). Since protobuf is a binary format the output is base64
+// encoded.
+type CookieEncoder struct{}
+
+func (e CookieEncoder) Encode(v interface{}, c *http.Cookie) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protocookie: %T doesn't implement proto.Message", v)
+	}
+
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	c.Value = base64.StdEncoding.EncodeToString(b)
+	return nil
+}
+
+func (e CookieEncoder) Decode(v interface{}, c *http.Cookie) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protocookie: %T doesn't implement proto.Message", v)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(c.Value)
+	if err != nil {
+		return err
+	}
+
+	return proto.Unmarshal(b, m)
+}
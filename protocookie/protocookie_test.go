@@ -0,0 +1,26 @@
+package protocookie
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func FuzzDecode(f *testing.F) {
+	v, err := structpb.NewStruct(map[string]interface{}{"user_id": 42, "tags": []interface{}{"a", "b"}})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	c := &http.Cookie{Name: "name"}
+	if err := (CookieEncoder{}).Encode(v, c); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(c.Value)
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		(CookieEncoder{}).Decode(new(structpb.Struct), &http.Cookie{Name: "name", Value: s})
+	})
+}
@@ -0,0 +1,94 @@
+package cookies
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RailsSerializer selects how cookie values are laid out inside the encrypted payload, to match the
+// Rails cookie jar configuration of the app sharing the cookies. Values are expected to already be
+// JSON, as produced by JSONCookieEncoder, matching Rails' :json cookies_serializer. The :marshal
+// serializer can't be supported.
+type RailsSerializer int
+
+const (
+	// RailsJSON stores the JSON value as is, matching Rails before 6.0, or later versions with
+	// use_cookies_with_metadata disabled.
+	RailsJSON RailsSerializer = iota
+	// RailsJSONWithMetadata wraps the JSON value in Rails' metadata envelope, recording the cookie name
+	// as its purpose and the cookie expiration, matching Rails 6.0 through 7.0 with
+	// use_cookies_with_metadata enabled. Rails 7.1's message serializers aren't supported.
+	RailsJSONWithMetadata
+)
+
+// railsMetadataTimeFormat is how Rails formats the expiration in the metadata envelope.
+const railsMetadataTimeFormat = "2006-01-02T15:04:05.000Z"
+
+type railsMetadataEnvelope struct {
+	Rails *railsMetadata `json:"_rails"`
+}
+
+type railsMetadata struct {
+	Message string  `json:"message"`
+	Exp     *string `json:"exp"`
+	Pur     string  `json:"pur"`
+}
+
+func railsCookiePurpose(cookie *http.Cookie) string {
+	return "cookie." + cookie.Name
+}
+
+// wrapRailsMetadata wraps the value of cookie in Rails' metadata envelope.
+func wrapRailsMetadata(cookie *http.Cookie) (string, error) {
+	md := &railsMetadata{
+		Message: base64.StdEncoding.EncodeToString([]byte(cookie.Value)),
+		Pur:     railsCookiePurpose(cookie),
+	}
+
+	if !cookie.Expires.IsZero() {
+		exp := cookie.Expires.UTC().Format(railsMetadataTimeFormat)
+		md.Exp = &exp
+	}
+
+	b, err := json.Marshal(railsMetadataEnvelope{md})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// unwrapRailsMetadata extracts the value of cookie from Rails' metadata envelope, checking it was
+// issued for this cookie and hasn't expired at now, unless now is zero. Values without an envelope are
+// returned as is so cookies written before enabling metadata can still be read.
+func unwrapRailsMetadata(cookie *http.Cookie, now time.Time) (string, error) {
+	var env railsMetadataEnvelope
+	if err := json.Unmarshal([]byte(cookie.Value), &env); err != nil || env.Rails == nil {
+		return cookie.Value, nil
+	}
+
+	if env.Rails.Pur != railsCookiePurpose(cookie) {
+		return "", fmt.Errorf("%w: purpose %q doesn't match cookie %q", ErrInvalidSignature, env.Rails.Pur, cookie.Name)
+	}
+
+	if env.Rails.Exp != nil && !now.IsZero() {
+		exp, err := time.Parse(time.RFC3339, *env.Rails.Exp)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+		}
+
+		if !now.Before(exp) {
+			return "", fmt.Errorf("%w: %q expired at %s", ErrCookieExpired, cookie.Name, *env.Rails.Exp)
+		}
+	}
+
+	value, err := base64.StdEncoding.DecodeString(env.Rails.Message)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+
+	return string(value), nil
+}
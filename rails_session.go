@@ -0,0 +1,161 @@
+package cookies
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// RailsSession holds the keys Rails stores in every session. It's meant to be embedded in the structs
+// sessions shared with a Rails app are decoded into using RailsSessionEncoder. It embeds UnknownFields
+// so the keys the struct doesn't declare, such as Warden's, are written back untouched.
+type RailsSession struct {
+	SessionID string `json:"session_id,omitempty"`
+	CSRFToken string `json:"_csrf_token,omitempty"`
+	UnknownFields
+}
+
+// RailsSessionEncoder encodes sessions as JSON like JSONCookieEncoder, but maps Rails' snake_case
+// session keys to struct fields without a json tag indifferently: user_id, userId and UserID are all
+// decoded into a UserID field. Untagged fields are encoded using snake_case keys so Rails can read
+// them, and keys the struct doesn't declare are preserved as with PreserveUnknownFields. Only the
+// fields of the session struct itself are mapped, nested values are decoded as usual.
+type RailsSessionEncoder struct {
+	// UseNumber is like JSONCookieEncoder.UseNumber.
+	UseNumber bool
+}
+
+func (e RailsSessionEncoder) Encode(v interface{}, c *http.Cookie) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if fields := railsFieldNames(reflect.TypeOf(v)); len(fields) > 0 {
+		renames := make(map[string]string, len(fields))
+		for _, name := range fields {
+			renames[name] = snakeCase(name)
+		}
+
+		if b, err = renameJSONKeys(b, renames); err != nil {
+			return err
+		}
+	}
+
+	if b, err = restoreUnknownFields(v, b); err != nil {
+		return err
+	}
+
+	c.Value = string(b)
+	return nil
+}
+
+func (e RailsSessionEncoder) Decode(v interface{}, c *http.Cookie) error {
+	renamed := *c
+
+	if fields := railsFieldNames(reflect.TypeOf(v)); len(fields) > 0 {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(c.Value), &obj); err == nil {
+			renames := map[string]string{}
+			for key := range obj {
+				if name, ok := fields[normalizeRailsKey(key)]; ok {
+					renames[key] = name
+				}
+			}
+
+			b, err := renameJSONKeys([]byte(c.Value), renames)
+			if err != nil {
+				return err
+			}
+			renamed.Value = string(b)
+		}
+	}
+
+	return JSONCookieEncoder{UseNumber: e.UseNumber, PreserveUnknownFields: true}.Decode(v, &renamed)
+}
+
+// railsFieldNames returns the names of the untagged fields of the struct t points to, including those
+// promoted from embedded structs, keyed by their normalized name.
+func railsFieldNames(t reflect.Type) map[string]string {
+	names := map[string]string{}
+
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			for key, name := range railsFieldNames(f.Type) {
+				names[key] = name
+			}
+			continue
+		}
+
+		if name, _, _ := strings.Cut(tag, ","); name == "" && tag != "-" && f.IsExported() {
+			names[normalizeRailsKey(f.Name)] = f.Name
+		}
+	}
+
+	return names
+}
+
+// normalizeRailsKey lowercases key and drops its underscores, so snake_case and CamelCase spellings
+// of the same name match.
+func normalizeRailsKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", ""))
+}
+
+// snakeCase converts a Go field name to snake_case, keeping initialisms together: UserID becomes
+// user_id and CSRFToken csrf_token.
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
+
+// renameJSONKeys renames the keys of the JSON object data according to renames. Data that isn't an
+// object is returned as is.
+func renameJSONKeys(data []byte, renames map[string]string) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return data, nil
+	}
+
+	changed := false
+	for from, to := range renames {
+		value, ok := obj[from]
+		if !ok || from == to {
+			continue
+		}
+
+		delete(obj, from)
+		obj[to] = value
+		changed = true
+	}
+
+	if !changed {
+		return data, nil
+	}
+
+	return json.Marshal(obj)
+}
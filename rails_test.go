@@ -0,0 +1,75 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRailsMetadataExpiryUsesClock(t *testing.T) {
+	issued := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issued
+	clock := ClockFunc(func() time.Time { return now })
+
+	ce := NewCookieEncryptorWithOptions("secret", WithRailsSerializer(RailsJSONWithMetadata), WithClock(clock))
+	cookie := &http.Cookie{Name: "name", Value: `"value"`, Expires: issued.Add(time.Hour)}
+	if err := ce.Encrypt(cookie); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := cookie.Value
+
+	decrypt := func() error {
+		cookie := &http.Cookie{Name: "name", Value: encrypted}
+		return ce.Decrypt(cookie)
+	}
+	get := func() error {
+		cm := &SecureCookieManager{Encryptor: ce, Encoder: JSONCookieEncoder{}, Clock: clock}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "name", Value: encrypted})
+
+		var v string
+		_, err := cm.Get(req, "name", &v)
+		return err
+	}
+
+	now = issued.Add(30 * time.Minute)
+	if err := decrypt(); err != nil {
+		t.Errorf("Decrypt before expiry returned %v", err)
+	}
+	if err := get(); err != nil {
+		t.Errorf("Get before expiry returned %v", err)
+	}
+
+	now = issued.Add(2 * time.Hour)
+	if err := decrypt(); !errors.Is(err, ErrCookieExpired) {
+		t.Errorf("Decrypt after expiry returned %v, want ErrCookieExpired", err)
+	}
+	if err := get(); !errors.Is(err, ErrCookieExpired) {
+		t.Errorf("Get after expiry returned %v, want ErrCookieExpired", err)
+	}
+}
+
+// rails7Cookie is a session cookie in the format of Rails 7.0 defaults, aes-256-gcm with metadata and
+// keys derived using PBKDF2-HMAC-SHA256, for the secret_key_base "rails 7 secret key base". It was
+// built using openssl and Python rather than Rails itself.
+const rails7Cookie = "g4oGlZ2bTI8ZyEAgEZQfwBxLbCWmPqSzR3jFJYb12at8L9xtccftXELSOn6wStZjtR+Z0E5gCdGmRKxLDYGm8qdP9mZIklOBmV770C1NaA==--AAECAwQFBgcICQoL--ubytd46SDGcw4aCzyYDUeQ=="
+
+func TestRails7Cookie(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("rails 7 secret key base", WithCipher(GCM), WithKeyDerivation(PBKDF2SHA256),
+		WithRailsSerializer(RailsJSONWithMetadata))
+
+	cookie := &http.Cookie{Name: "session", Value: rails7Cookie}
+	if err := ce.Decrypt(cookie); err != nil {
+		t.Fatal(err)
+	}
+	if cookie.Value != `{"user_id":42}` {
+		t.Errorf("decrypted %q", cookie.Value)
+	}
+
+	sha1 := NewCookieEncryptorWithOptions("rails 7 secret key base", WithCipher(GCM), WithRailsSerializer(RailsJSONWithMetadata))
+	if err := sha1.Decrypt(&http.Cookie{Name: "session", Value: rails7Cookie}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("decrypting using PBKDF2-HMAC-SHA1 keys returned %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,56 @@
+package cookies
+
+import (
+	"context"
+	"time"
+)
+
+// RedisClient is the subset of a Redis client used by RedisSessionManager. It's small enough to be
+// implemented by a thin adapter over clients such as go-redis.
+type RedisClient interface {
+	// Get returns the value stored at key, or ErrSessionNotFound if there is none.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores value at key, expiring it after ttl unless ttl is zero.
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	// Del deletes key.
+	Del(ctx context.Context, key string) error
+}
+
+// RedisSessionManager manages sessions by storing their data in Redis under a random ID, keeping only
+// the encrypted ID in the cookie. It's suited for sessions too large to fit in a cookie.
+type RedisSessionManager struct {
+	serverSessions
+	client RedisClient
+
+	// KeyPrefix is prepended to session IDs to build Redis keys.
+	KeyPrefix string
+	// TTL is how long sessions are kept in Redis after their last update. Zero keeps them until
+	// they're destroyed.
+	TTL time.Duration
+}
+
+// NewRedisSessionManager creates a new Redis-based session manager. The cookie holding the session ID
+// is written by cm, whose Encoder is also used to serialize sessions stored in Redis.
+func NewRedisSessionManager(client RedisClient, cm *SecureCookieManager, name string, opts *CookieOptions) *RedisSessionManager {
+	sm := &RedisSessionManager{client: client, KeyPrefix: "session:"}
+	sm.serverSessions = serverSessions{store: redisStore{sm}, cm: cm, name: name, opts: opts}
+
+	return sm
+}
+
+// redisStore implements sessionStore on top of a RedisSessionManager's client.
+type redisStore struct {
+	sm *RedisSessionManager
+}
+
+func (s redisStore) get(ctx context.Context, id string) (string, error) {
+	return s.sm.client.Get(ctx, s.sm.KeyPrefix+id)
+}
+
+func (s redisStore) set(ctx context.Context, id string, data string) error {
+	return s.sm.client.Set(ctx, s.sm.KeyPrefix+id, data, s.sm.TTL)
+}
+
+func (s redisStore) del(ctx context.Context, id string) error {
+	return s.sm.client.Del(ctx, s.sm.KeyPrefix+id)
+}
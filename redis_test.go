@@ -0,0 +1,155 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements RedisClient in memory, expiring keys according to now.
+type fakeRedis struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	values map[string]fakeRedisValue
+}
+
+type fakeRedisValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newFakeRedis(now func() time.Time) *fakeRedis {
+	return &fakeRedis{now: now, values: map[string]fakeRedisValue{}}
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.values[key]
+	if !ok || (!v.expiresAt.IsZero() && !r.now().Before(v.expiresAt)) {
+		return "", ErrSessionNotFound
+	}
+
+	return v.value, nil
+}
+
+func (r *fakeRedis) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := fakeRedisValue{value: value}
+	if ttl != 0 {
+		v.expiresAt = r.now().Add(ttl)
+	}
+
+	r.values[key] = v
+	return nil
+}
+
+func (r *fakeRedis) Del(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.values, key)
+	return nil
+}
+
+// sessionID returns the session ID held by the session cookie written to rec.
+func sessionID(t *testing.T, cm *SecureCookieManager, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	id, err := cm.GetRaw(requestWithCookies(rec), "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestRedisSessionManager(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := newFakeRedis(func() time.Time { return now })
+	cm := newTestManager()
+
+	sm := NewRedisSessionManager(client, cm, "session", nil)
+	sm.TTL = time.Hour
+
+	rec := httptest.NewRecorder()
+	if err := sm.Update(rec, httptest.NewRequest(http.MethodGet, "/", nil), &testSession{UserID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	id := sessionID(t, cm, rec)
+	if _, err := client.Get(context.Background(), "session:"+id); err != nil {
+		t.Fatalf("the session isn't stored under its key: %v", err)
+	}
+
+	req := requestWithCookies(rec)
+	var sess testSession
+	if err := sm.Current(req, &sess); err != nil || sess.UserID != "42" {
+		t.Fatalf("loaded %+v, %v, want user 42", sess, err)
+	}
+
+	// Updating keeps the ID.
+	rec = httptest.NewRecorder()
+	if err := sm.Update(rec, req, &testSession{UserID: "43"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionID(t, cm, rec); got != id {
+		t.Errorf("updating the session changed its ID from %q to %q", id, got)
+	}
+
+	// Regenerating stores the session under a new ID, deleting the old one.
+	rec = httptest.NewRecorder()
+	if err := sm.Regenerate(rec, req, &testSession{UserID: "43"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionID(t, cm, rec); got == id {
+		t.Error("regenerating the session kept its ID")
+	}
+	if err := sm.Current(req, &sess); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("reading the session replaced by Regenerate returned %v, want ErrSessionNotFound", err)
+	}
+
+	req = requestWithCookies(rec)
+	if err := sm.Current(req, &sess); err != nil || sess.UserID != "43" {
+		t.Fatalf("loaded %+v, %v, want user 43", sess, err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := sm.Current(req, &sess); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("reading an expired session returned %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestServerSessionsReplaceUnknownIDs(t *testing.T) {
+	cm := newTestManager()
+	managers := map[string]SessionManager{
+		"memory": NewMemorySessionManager(cm, "session", nil),
+		"redis":  NewRedisSessionManager(newFakeRedis(time.Now), cm, "session", nil),
+	}
+
+	for name, sm := range managers {
+		t.Run(name, func(t *testing.T) {
+			// The cookie is valid but the store holds no session for it, as when it expired or was
+			// planted by an attacker.
+			rec := httptest.NewRecorder()
+			if _, err := cm.SetRaw(rec, "session", nil, "planted"); err != nil {
+				t.Fatal(err)
+			}
+
+			rec2 := httptest.NewRecorder()
+			if err := sm.Update(rec2, requestWithCookies(rec), &testSession{UserID: "42"}); err != nil {
+				t.Fatal(err)
+			}
+			if id := sessionID(t, cm, rec2); id == "planted" {
+				t.Error("the session was stored under the ID chosen by the client")
+			}
+		})
+	}
+}
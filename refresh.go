@@ -0,0 +1,138 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RefreshManager pairs short-lived sessions with a longer-lived refresh cookie, as used by single-page
+// apps: when the session has expired, the refresh cookie allows minting a new one without logging in
+// again. The refresh cookie only records the session's subject, such as the user ID, and its own
+// expiration, Mint rebuilds the session from the subject.
+//
+// The refresh cookie is always HttpOnly, and its options must set Path to the endpoint refreshing
+// sessions so browsers don't send it with every request.
+type RefreshManager struct {
+	sessions SessionManager
+	cm       *SecureCookieManager
+	name     string
+	opts     *CookieOptions
+
+	// ExpiresIn is the lifetime of refresh cookies, recorded inside them so it can't be extended by
+	// the client. Zero leaves it to the cookie's own expiration.
+	ExpiresIn time.Duration
+	// Mint fills sess for subject when refreshing it, for instance loading the user. It should fail
+	// for subjects that can no longer log in.
+	Mint func(req *http.Request, subject string, sess Session) error
+	// Clock is used to check refresh cookie expiration. Defaults to the SecureCookieManager's clock.
+	Clock Clock
+}
+
+// refreshToken is the content of refresh cookies.
+type refreshToken struct {
+	Subject   string
+	ExpiresAt int64
+}
+
+// NewRefreshManager creates a RefreshManager storing sessions using sessions, and refresh cookies in
+// the cookie name using cm and opts. It panics if opts doesn't restrict Path to a refresh endpoint,
+// since the refresh cookie would then be sent with every request.
+func NewRefreshManager(sessions SessionManager, cm *SecureCookieManager, name string, opts *CookieOptions) *RefreshManager {
+	if opts == nil || opts.Path == "" || opts.Path == "/" {
+		panic("cookies: NewRefreshManager requires opts.Path to be set to the refresh endpoint")
+	}
+
+	refreshOpts := *opts
+	refreshOpts.HTTPOnly = true
+
+	return &RefreshManager{sessions: sessions, cm: cm, name: name, opts: &refreshOpts}
+}
+
+// Login writes sess along with a refresh cookie for subject. Session managers supporting it are asked
+// to regenerate the session, preventing session fixation.
+func (rm *RefreshManager) Login(w http.ResponseWriter, req *http.Request, sess Session, subject string) error {
+	if r, ok := rm.sessions.(interface {
+		Regenerate(http.ResponseWriter, *http.Request, Session) error
+	}); ok {
+		if err := r.Regenerate(w, req, sess); err != nil {
+			return err
+		}
+	} else if err := rm.sessions.Update(w, req, sess); err != nil {
+		return err
+	}
+
+	token := refreshToken{Subject: subject}
+	if rm.ExpiresIn != 0 {
+		token.ExpiresAt = rm.now().Add(rm.ExpiresIn).Unix()
+	}
+
+	_, err := rm.cm.SetContext(req.Context(), w, rm.name, rm.opts, &token)
+	return err
+}
+
+// Current fetches the current session into sess like the session manager's Current. When the request
+// has no usable session, because it's missing, expired, tampered or no longer stored, but carries a
+// valid refresh cookie, a new session is minted and written instead. It reports whether that was the
+// case.
+func (rm *RefreshManager) Current(w http.ResponseWriter, req *http.Request, sess Session) (bool, error) {
+	err := rm.currentSession(req, sess)
+	if err == nil || !startsNewSession(err) {
+		return false, err
+	}
+
+	if _, rerr := req.Cookie(rm.name); rerr != nil {
+		// Cookie session managers with New set start a new session instead of failing.
+		return false, rm.sessions.Current(req, sess)
+	}
+
+	if err := rm.Refresh(w, req, sess); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Refresh mints a new session into sess from the refresh cookie sent with req and writes it, whatever
+// the state of the current session. Expired refresh cookies return ErrSessionExpired.
+func (rm *RefreshManager) Refresh(w http.ResponseWriter, req *http.Request, sess Session) error {
+	var token refreshToken
+	if _, err := rm.cm.Get(req, rm.name, &token); err != nil {
+		return err
+	}
+
+	if token.ExpiresAt != 0 && !rm.now().Before(time.Unix(token.ExpiresAt, 0)) {
+		return fmt.Errorf("%w: refresh cookie %q", ErrSessionExpired, rm.name)
+	}
+
+	if err := rm.Mint(req, token.Subject, sess); err != nil {
+		return err
+	}
+
+	return rm.sessions.Update(w, req, sess)
+}
+
+// currentSession fetches the current session into sess, without letting cookie session managers with
+// New set start a new one, so requests without a usable session are still told apart.
+func (rm *RefreshManager) currentSession(req *http.Request, sess Session) error {
+	if sm, ok := rm.sessions.(*CookieSessionManager); ok {
+		_, _, err := sm.decode(req, sess)
+		return err
+	}
+
+	return rm.sessions.Current(req, sess)
+}
+
+// Logout deletes the refresh cookie. The session itself must be destroyed using its manager.
+func (rm *RefreshManager) Logout(w http.ResponseWriter) error {
+	_, err := rm.cm.Delete(w, rm.name, rm.opts)
+	return err
+}
+
+func (rm *RefreshManager) now() time.Time {
+	if rm.Clock == nil {
+		return rm.cm.now()
+	}
+
+	return rm.Clock.Now()
+}
@@ -0,0 +1,119 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testSession struct {
+	UserID string `json:"user_id"`
+}
+
+func (s *testSession) Validate(*http.Request) error { return nil }
+
+// notFoundSessions is a SessionManager whose sessions are never found, like a server-side store that
+// lost them.
+type notFoundSessions struct {
+	updated int
+}
+
+func (sm *notFoundSessions) Current(*http.Request, Session) error {
+	return fmt.Errorf("%w: id", ErrSessionNotFound)
+}
+
+func (sm *notFoundSessions) Update(http.ResponseWriter, *http.Request, Session) error {
+	sm.updated++
+	return nil
+}
+
+func newTestManager() *SecureCookieManager {
+	return &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("secret"), Encoder: JSONCookieEncoder{}}
+}
+
+// refreshRequest returns a request carrying only a refresh cookie for subject.
+func refreshRequest(t *testing.T, rm *RefreshManager, subject string) *http.Request {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := rm.Login(rec, httptest.NewRequest(http.MethodGet, "/", nil), &testSession{}, subject); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/refresh", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "refresh" {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	return req
+}
+
+func TestRefreshManagerRefreshesUnusableSessions(t *testing.T) {
+	mint := func(req *http.Request, subject string, sess Session) error {
+		sess.(*testSession).UserID = subject
+		return nil
+	}
+
+	withNew := NewCookieSessionManager(newTestManager(), "session", nil)
+	withNew.New = func(*http.Request) (Session, error) { return &testSession{}, nil }
+
+	for name, sessions := range map[string]SessionManager{
+		"session not found": &notFoundSessions{},
+		"cookie missing":    NewCookieSessionManager(newTestManager(), "session", nil),
+		"New set":           withNew,
+	} {
+		rm := NewRefreshManager(sessions, newTestManager(), "refresh", &CookieOptions{Path: "/refresh"})
+		rm.Mint = mint
+
+		var sess testSession
+		refreshed, err := rm.Current(httptest.NewRecorder(), refreshRequest(t, rm, "42"), &sess)
+		if err != nil || !refreshed || sess.UserID != "42" {
+			t.Errorf("%s: Current returned %t, %v, session %+v", name, refreshed, err, sess)
+		}
+	}
+}
+
+func TestRefreshManagerWithoutRefreshCookie(t *testing.T) {
+	sessions := NewCookieSessionManager(newTestManager(), "session", nil)
+	sessions.New = func(*http.Request) (Session, error) { return &testSession{UserID: "new"}, nil }
+	rm := NewRefreshManager(sessions, newTestManager(), "refresh", &CookieOptions{Path: "/refresh"})
+
+	var sess testSession
+	refreshed, err := rm.Current(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), &sess)
+	if err != nil || refreshed || sess.UserID != "new" {
+		t.Errorf("Current returned %t, %v, session %+v, want a new session", refreshed, err, sess)
+	}
+}
+
+func TestRefreshManagerRejectsExpiredRefreshCookies(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rm := NewRefreshManager(&notFoundSessions{}, newTestManager(), "refresh", &CookieOptions{Path: "/refresh"})
+	rm.Clock = ClockFunc(func() time.Time { return now })
+	rm.ExpiresIn = time.Hour
+	rm.Mint = func(*http.Request, string, Session) error { return nil }
+
+	req := refreshRequest(t, rm, "42")
+	now = now.Add(2 * time.Hour)
+
+	if refreshed, err := rm.Current(httptest.NewRecorder(), req, &testSession{}); refreshed || err == nil {
+		t.Errorf("Current returned %t, %v for an expired refresh cookie", refreshed, err)
+	}
+}
+
+func TestNewRefreshManagerRequiresPath(t *testing.T) {
+	for _, opts := range []*CookieOptions{nil, {}, {Path: "/"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewRefreshManager accepted options %+v", opts)
+				}
+			}()
+
+			NewRefreshManager(&notFoundSessions{}, newTestManager(), "refresh", opts)
+		}()
+	}
+}
@@ -0,0 +1,88 @@
+package cookies
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type requestCacheContextKey struct{}
+
+// requestCache holds the cookies decrypted while serving a request, so reading them again doesn't
+// redo the crypto.
+type requestCache struct {
+	mu      sync.Mutex
+	entries map[requestCacheKey]requestCacheEntry
+}
+
+// requestCacheKey identifies a cached cookie. The manager is part of it since managers may read the
+// same cookie differently, even when sharing their encryptor, and so is the encryptor since copies of
+// a manager may use different ones, such as SetSigned's.
+type requestCacheKey struct {
+	manager   *SecureCookieManager
+	encryptor *CookieEncryptor
+	name      string
+}
+
+type requestCacheEntry struct {
+	cookie    http.Cookie
+	encrypted string
+	stale     bool
+}
+
+// ContextWithRequestCache returns a copy of ctx holding an empty cache for decrypted cookies. It's
+// only used by managers with EnableRequestCache set.
+func ContextWithRequestCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestCacheContextKey{}, &requestCache{entries: map[requestCacheKey]requestCacheEntry{}})
+}
+
+// RequestCacheMiddleware installs a cache for decrypted cookies in the request context, see
+// ContextWithRequestCache.
+func RequestCacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(ContextWithRequestCache(req.Context())))
+	})
+}
+
+// ClearRequestCache drops the cached cookie name from the request cache, if any, so the next read
+// decrypts it again. Session managers call it when updating sessions.
+func ClearRequestCache(req *http.Request, name string) {
+	rc := requestCacheFrom(req)
+	if rc == nil {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for key := range rc.entries {
+		if key.name == name {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+func requestCacheFrom(req *http.Request) *requestCache {
+	if req == nil {
+		return nil
+	}
+
+	rc, _ := req.Context().Value(requestCacheContextKey{}).(*requestCache)
+	return rc
+}
+
+// get returns the entry for key. The entry is a copy, so callers can't modify the cached cookie.
+func (rc *requestCache) get(key requestCacheKey) (requestCacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	return entry, ok
+}
+
+func (rc *requestCache) set(key requestCacheKey, entry requestCacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.entries[key] = entry
+}
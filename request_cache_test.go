@@ -0,0 +1,120 @@
+package cookies
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// cachedRequest returns req with an empty request cache, as RequestCacheMiddleware installs.
+func cachedRequest(t *testing.T, req *http.Request) *http.Request {
+	t.Helper()
+
+	var cached *http.Request
+	RequestCacheMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cached = req
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return cached
+}
+
+func TestRequestCacheSkipsDecryptingAgain(t *testing.T) {
+	cm := newTestManager()
+	cm.EnableRequestCache = true
+	req := cachedRequest(t, setCookieRequest(t, cm, "name", "value"))
+
+	var got string
+	if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+		t.Fatalf("got %q, %v, want %q", got, err, "value")
+	}
+
+	// Reading the cookie again uses the cached value, even though it can't be decrypted anymore.
+	req.Header.Set("Cookie", "name=tampered")
+	got = ""
+	if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+		t.Fatalf("got %q, %v from the cache, want %q", got, err, "value")
+	}
+	if _, err := cm.WithEncoder(JSONCookieEncoder{UseNumber: true}).Get(req, "name", &got); err != nil {
+		t.Fatalf("reading using a copy with another encoder returned %v, want the cached value", err)
+	}
+
+	ClearRequestCache(req, "name")
+	if _, err := cm.Get(req, "name", &got); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("reading a cleared cookie returned %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestRequestCacheIsolatesManagers(t *testing.T) {
+	old := NewCookieEncryptorWithOptions("old secret")
+	lenient := &SecureCookieManager{
+		Encryptor: NewCookieEncryptorWithOptions("secret"), FallbackEncryptors: []*CookieEncryptor{old},
+		Encoder: JSONCookieEncoder{}, EnableRequestCache: true,
+	}
+	strict := &SecureCookieManager{Encryptor: lenient.Encryptor, Encoder: JSONCookieEncoder{}, EnableRequestCache: true}
+	secure := &SecureCookieManager{
+		Encryptor: lenient.Encryptor, Encoder: JSONCookieEncoder{}, EnableRequestCache: true,
+		SecureRequest: RequestIsTLS,
+	}
+
+	req := cachedRequest(t, setCookieRequest(t, &SecureCookieManager{Encryptor: old, Encoder: JSONCookieEncoder{}}, "name", "value"))
+
+	var got string
+	if _, err := lenient.Get(req, "name", &got); err != nil || got != "value" {
+		t.Fatalf("got %q, %v, want %q", got, err, "value")
+	}
+
+	if _, err := strict.Get(req, "name", &got); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("manager without fallback encryptors returned %v, want ErrInvalidSignature", err)
+	}
+	if _, err := secure.Get(req, "name", &got); !errors.Is(err, ErrInsecureRequest) {
+		t.Errorf("manager requiring TLS returned %v, want ErrInsecureRequest", err)
+	}
+}
+
+func TestRequestCacheRejectsInsecureRequestsAfterSecureReads(t *testing.T) {
+	cm := newTestManager()
+	cm.EnableRequestCache = true
+	cm.SecureRequest = RequestIsTLS
+
+	req := cachedRequest(t, setCookieRequest(t, cm, "name", "value"))
+	req.TLS = &tls.ConnectionState{}
+
+	var got string
+	if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+		t.Fatalf("got %q, %v, want %q", got, err, "value")
+	}
+
+	// The copy shares the request context, and so its cache.
+	insecure := req.Clone(req.Context())
+	insecure.TLS = nil
+	if _, err := cm.Get(insecure, "name", &got); !errors.Is(err, ErrInsecureRequest) {
+		t.Errorf("reading a cached cookie over plain HTTP returned %v, want ErrInsecureRequest", err)
+	}
+}
+
+func TestRequestCacheConcurrentReads(t *testing.T) {
+	cm := newTestManager()
+	cm.EnableRequestCache = true
+	req := cachedRequest(t, setCookieRequest(t, cm, "name", "value"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				var got string
+				if _, err := cm.Get(req, "name", &got); err != nil || got != "value" {
+					t.Errorf("got %q, %v, want %q", got, err, "value")
+					return
+				}
+				ClearRequestCache(req, "name")
+			}
+		}()
+	}
+	wg.Wait()
+}
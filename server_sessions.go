@@ -0,0 +1,139 @@
+package cookies
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// sessionStore stores encoded sessions by ID on behalf of serverSessions.
+type sessionStore interface {
+	get(ctx context.Context, id string) (string, error)
+	set(ctx context.Context, id string, data string) error
+	del(ctx context.Context, id string) error
+}
+
+// serverSessions implements session managers storing sessions server-side under a random ID, keeping
+// only the encrypted ID in the cookie.
+type serverSessions struct {
+	store sessionStore
+	cm    *SecureCookieManager
+	name  string
+	opts  *CookieOptions
+
+	// CSRF, when set, has its token rotated whenever the session is regenerated.
+	CSRF *CSRFManager
+}
+
+// Current fetches the current session from the store using the ID in the request cookie. Once
+// decoded, the session is checked using its Validate method.
+func (ss *serverSessions) Current(req *http.Request, sess Session) error {
+	id, err := ss.cm.GetRaw(req, ss.name)
+	if err != nil {
+		return err
+	}
+
+	data, err := ss.store.get(req.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	if err := ss.cm.Encoder.Decode(sess, &http.Cookie{Name: ss.name, Value: data}); err != nil {
+		return err
+	}
+
+	return sess.Validate(req)
+}
+
+// Update stores the session, under the ID in the request cookie or a new one if there is none, and
+// refreshes the cookie. IDs the store holds no session for, for instance because it expired, are
+// replaced too so clients can't choose the ID of new sessions.
+func (ss *serverSessions) Update(w http.ResponseWriter, req *http.Request, sess Session) error {
+	id, err := ss.existingID(req)
+	if err != nil {
+		return err
+	}
+
+	if id == "" {
+		if id, err = randomToken(); err != nil {
+			return err
+		}
+	}
+
+	return ss.save(w, req.Context(), id, sess)
+}
+
+// existingID returns the ID in the request cookie if the store holds a session for it, or an empty
+// string.
+func (ss *serverSessions) existingID(req *http.Request) (string, error) {
+	id, err := ss.cm.GetRaw(req, ss.name)
+	if err != nil {
+		return "", nil
+	}
+
+	if _, err := ss.store.get(req.Context(), id); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Regenerate stores the session under a new ID, deleting the previous one so cookies captured before
+// the regeneration can no longer be used. If sess implements IdentifiableSession it's assigned the
+// new ID. The CSRF token, if configured, is rotated too.
+func (ss *serverSessions) Regenerate(w http.ResponseWriter, req *http.Request, sess Session) error {
+	if oldID, err := ss.cm.GetRaw(req, ss.name); err == nil {
+		if err := ss.store.del(req.Context(), oldID); err != nil {
+			return err
+		}
+	}
+	ClearRequestCache(req, ss.name)
+
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if is, ok := sess.(IdentifiableSession); ok {
+		is.SetSessionID(id)
+	}
+
+	if ss.CSRF != nil {
+		if _, err := ss.CSRF.Rotate(w); err != nil {
+			return err
+		}
+	}
+
+	return ss.save(w, req.Context(), id, sess)
+}
+
+// Destroy deletes the session from the store and deletes its cookie.
+func (ss *serverSessions) Destroy(w http.ResponseWriter, req *http.Request) error {
+	if id, err := ss.cm.GetRaw(req, ss.name); err == nil {
+		if err := ss.store.del(req.Context(), id); err != nil {
+			return err
+		}
+	}
+	ClearRequestCache(req, ss.name)
+
+	_, err := ss.cm.Delete(w, ss.name, ss.opts)
+	return err
+}
+
+func (ss *serverSessions) save(w http.ResponseWriter, ctx context.Context, id string, sess Session) error {
+	cookie := &http.Cookie{Name: ss.name}
+	if err := ss.cm.Encoder.Encode(sess, cookie); err != nil {
+		return err
+	}
+
+	if err := ss.store.set(ctx, id, cookie.Value); err != nil {
+		return err
+	}
+
+	_, err := ss.cm.setRaw(ctx, w, ss.name, ss.opts, id)
+	return err
+}
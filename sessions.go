@@ -1,13 +1,42 @@
 package cookies
 
-import "net/http"
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
 
+// SessionConstructor builds a new, empty session for the request, see CookieSessionManager.New.
 type SessionConstructor func(*http.Request) (Session, error)
 
 type Session interface {
 	Validate(*http.Request) error
 }
 
+// IdentifiableSession is implemented by sessions holding an identifier, for instance one used to
+// look up server-side state, that must be replaced when the session is regenerated.
+type IdentifiableSession interface {
+	Session
+	SetSessionID(id string)
+}
+
+// randomToken generates a random URL-safe token, used for session IDs and CSRF tokens.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 // SessionManager defines the basic interface for different session backends.
 type SessionManager interface {
 	Current(*http.Request, Session) error
@@ -19,21 +48,359 @@ type CookieSessionManager struct {
 	cm   *SecureCookieManager
 	name string
 	opts *CookieOptions
+
+	// ExpiresIn enables storing the session expiration inside the encrypted cookie, so sessions expire
+	// after the given duration since their last update regardless of the cookie's own expiration.
+	// Expired sessions make Current return ErrSessionExpired. Zero disables it.
+	ExpiresIn time.Duration
+	// MaxLifetime caps the session's absolute lifetime: once that long has passed since the session
+	// was issued Current returns ErrSessionExpired, however often it was refreshed. The issue time is
+	// stored inside the encrypted cookie, kept by Update and only reset by Regenerate or once the
+	// session is over its lifetime. Zero disables it.
+	MaxLifetime time.Duration
+	// Clock is used to check session expiration. Defaults to the SecureCookieManager's clock.
+	Clock Clock
+
+	// SlidingExpiration makes CurrentAndRefresh re-issue the session cookie with a MaxAge of
+	// IdleTimeout, so active sessions stay alive while idle ones expire.
+	SlidingExpiration bool
+	// IdleTimeout is the MaxAge used when refreshing sessions with SlidingExpiration.
+	IdleTimeout time.Duration
+
+	// RewriteOnRead makes CurrentAndRefresh re-issue session cookies decrypted using a fallback secret
+	// or encryptor, or decoded using a fallback encoder, migrating them to the current one. The
+	// session's expiration is kept.
+	RewriteOnRead bool
+
+	// CSRF, when set, has its token rotated whenever the session is regenerated.
+	CSRF *CSRFManager
+
+	// New, when set, builds the session Current starts when the request carries no session cookie, or
+	// one that can't be decrypted or decoded or has expired, instead of returning the error. The session
+	// it builds is copied into the one passed to Current, so it must have the same type.
+	New SessionConstructor
 }
 
 // NewCookieSessionManager creates a new cookie-based session manager.
 func NewCookieSessionManager(cm *SecureCookieManager, name string, opts *CookieOptions) *CookieSessionManager {
-	return &CookieSessionManager{cm, name, opts}
+	return &CookieSessionManager{cm: cm, name: name, opts: opts}
 }
 
-// Current fetches the current session from the request cookie, starting one if it doesn't exist.
+// Current fetches the current session from the request cookie. Once decoded, the session is checked
+// using its Validate method. When the cookie is missing or invalid, a new session is started using New
+// if it's set.
 func (sm *CookieSessionManager) Current(req *http.Request, sess Session) error {
-	_, err := sm.cm.Get(req, sm.name, sess)
+	_, _, err := sm.current(req, sess)
 	return err
 }
 
+// Load returns the current session, decoded into a session built by New. Like Current, it returns a
+// new session built by New when the request carries no usable session cookie. New must be set.
+func (sm *CookieSessionManager) Load(req *http.Request) (Session, error) {
+	if sm.New == nil {
+		return nil, errors.New("cookies: Load requires CookieSessionManager.New to be set")
+	}
+
+	sess, err := sm.New(req)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil {
+		return nil, errors.New("cookies: SessionConstructor built a nil session")
+	}
+
+	if err := sm.Current(req, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// current implements Current. It returns the manager to use for rewriting the session cookie, which
+// keeps the session's expiration, and whether the cookie was decrypted using a fallback secret or
+// encryptor.
+func (sm *CookieSessionManager) current(req *http.Request, sess Session) (*SecureCookieManager, bool, error) {
+	cm, stale, err := sm.decode(req, sess)
+	if err == nil || sm.New == nil || !startsNewSession(err) {
+		return cm, stale, err
+	}
+
+	sm.cm.log(req.Context(), slog.LevelDebug, "starting new session", slog.String("cookie", sm.name), slog.String("error", err.Error()))
+
+	return cm, false, sm.newSession(req, sess)
+}
+
+// decode decodes and validates the session cookie sent with req into sess, see current.
+func (sm *CookieSessionManager) decode(req *http.Request, sess Session) (*SecureCookieManager, bool, error) {
+	cm := sm.cm
+	enc := &sessionEncoder{CookieEncoder: sm.cm.Encoder}
+	if sm.timestamped() {
+		cm = sm.cm.WithEncoder(enc)
+	}
+
+	_, stale, err := cm.get(req, sm.name, sess)
+	if err != nil {
+		return cm, false, err
+	}
+
+	if sm.ExpiresIn != 0 && !sm.now().Before(enc.ExpiresAt) {
+		sm.cm.log(req.Context(), slog.LevelInfo, "session expired", slog.String("cookie", sm.name), slog.Time("expires_at", enc.ExpiresAt))
+		return cm, false, ErrSessionExpired
+	}
+
+	if sm.MaxLifetime != 0 && !sm.now().Before(enc.IssuedAt.Add(sm.MaxLifetime)) {
+		sm.cm.log(req.Context(), slog.LevelInfo, "session lifetime exceeded", slog.String("cookie", sm.name), slog.Time("issued_at", enc.IssuedAt))
+		return cm, false, ErrSessionExpired
+	}
+
+	return cm, stale, sess.Validate(req)
+}
+
+// newSession replaces sess with a new session built by New.
+func (sm *CookieSessionManager) newSession(req *http.Request, sess Session) error {
+	created, err := sm.New(req)
+	if err != nil {
+		return err
+	}
+
+	dst, src := reflect.ValueOf(sess), reflect.ValueOf(created)
+	if created == nil || dst.Kind() != reflect.Pointer || dst.IsNil() || src.Type() != dst.Type() || src.IsNil() {
+		return fmt.Errorf("cookies: SessionConstructor built %T, Current was passed %T", created, sess)
+	}
+
+	dst.Elem().Set(src.Elem())
+	return nil
+}
+
+// startsNewSession reports whether err, returned reading a session cookie, means the request has no
+// usable session, so a new one can be started.
+func startsNewSession(err error) bool {
+	for _, target := range []error{
+		ErrCookieMissing, ErrCookieChunkMissing, ErrInvalidSignature, ErrDecryptFailed,
+		ErrUnknownFormatVersion, ErrDecodeFailed, ErrCookieExpired, ErrSessionExpired, ErrSessionNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CurrentIgnoringExpiry is like Current but also decodes sessions that have expired, either per
+// ExpiresIn or MaxLifetime or per the cookie's own recorded expiration, reporting whether they had.
+// Sessions aren't validated. It's meant for inspecting sessions in support and admin tooling, and
+// must never be used to authenticate requests.
+func (sm *CookieSessionManager) CurrentIgnoringExpiry(req *http.Request, sess Session) (bool, error) {
+	cm := sm.cm
+	enc := &sessionEncoder{CookieEncoder: sm.cm.Encoder}
+	if sm.timestamped() {
+		cm = sm.cm.WithEncoder(enc)
+	}
+
+	_, expired, err := cm.GetIgnoringExpiry(req, sm.name, sess)
+	if err != nil {
+		return false, err
+	}
+
+	now := sm.now()
+	if sm.ExpiresIn != 0 && !now.Before(enc.ExpiresAt) {
+		expired = true
+	}
+	if sm.MaxLifetime != 0 && !now.Before(enc.IssuedAt.Add(sm.MaxLifetime)) {
+		expired = true
+	}
+
+	return expired, nil
+}
+
+// CurrentAndRefresh is like Current but, when SlidingExpiration is enabled and the session is valid,
+// also re-issues the session cookie with a fresh expiration. The cookie is written at most once, and
+// not at all when neither SlidingExpiration nor RewriteOnRead apply.
+func (sm *CookieSessionManager) CurrentAndRefresh(w http.ResponseWriter, req *http.Request, sess Session) error {
+	_, err := sm.CurrentAndRewrite(w, req, sess)
+	return err
+}
+
+// CurrentAndRewrite is like CurrentAndRefresh but reports whether the session cookie was re-issued.
+// Besides SlidingExpiration, the cookie is re-issued when RewriteOnRead is enabled and the cookie was
+// decrypted using a fallback secret or encryptor.
+func (sm *CookieSessionManager) CurrentAndRewrite(w http.ResponseWriter, req *http.Request, sess Session) (bool, error) {
+	cm, stale, err := sm.current(req, sess)
+	if err != nil {
+		return false, err
+	}
+
+	if sm.SlidingExpiration {
+		var opts CookieOptions
+		if sm.opts != nil {
+			opts = *sm.opts
+		}
+		opts.MaxAge = sm.IdleTimeout
+		opts.Expires = time.Time{}
+
+		err := sm.UpdateWithOptions(w, req, sess, &opts)
+		return err == nil, err
+	}
+
+	if !sm.RewriteOnRead || !stale {
+		return false, nil
+	}
+
+	_, err = cm.SetContext(req.Context(), w, sm.name, sm.opts, sess)
+	return err == nil, err
+}
+
 // Update updates the session with the given struct, replacing the existing session data with it.
 func (sm *CookieSessionManager) Update(w http.ResponseWriter, req *http.Request, sess Session) error {
-	_, err := sm.cm.Set(w, sm.name, sm.opts, sess)
+	return sm.UpdateWithOptions(w, req, sess, nil)
+}
+
+// UpdateWithOptions is like Update but writes the cookie using opts instead of the manager's options,
+// for instance to extend the session's lifetime. The manager's options are used when opts is nil.
+func (sm *CookieSessionManager) UpdateWithOptions(w http.ResponseWriter, req *http.Request, sess Session, opts *CookieOptions) error {
+	return sm.update(w, req, sess, opts, false)
+}
+
+// update implements UpdateWithOptions. The issue time of the session in req is kept unless reissue is
+// set.
+func (sm *CookieSessionManager) update(w http.ResponseWriter, req *http.Request, sess Session, opts *CookieOptions, reissue bool) error {
+	if opts == nil {
+		opts = sm.opts
+	}
+
+	if !sm.timestamped() {
+		ClearRequestCache(req, sm.name)
+		_, err := sm.cm.SetContext(requestContext(req), w, sm.name, opts, sess)
+		return err
+	}
+
+	now := sm.now()
+	enc := &sessionEncoder{CookieEncoder: sm.cm.Encoder, IssuedAt: now, ExpiresAt: now.Add(sm.ExpiresIn)}
+	if issuedAt, ok := sm.issuedAt(req); ok && !reissue {
+		enc.IssuedAt = issuedAt
+	}
+
+	ClearRequestCache(req, sm.name)
+	_, err := sm.cm.WithEncoder(enc).SetContext(requestContext(req), w, sm.name, opts, sess)
 	return err
 }
+
+// issuedAt returns the issue time of the session cookie sent with req, if it's valid and within
+// MaxLifetime.
+func (sm *CookieSessionManager) issuedAt(req *http.Request) (time.Time, bool) {
+	if req == nil {
+		return time.Time{}, false
+	}
+
+	cookie, _, err := sm.cm.read(req, sm.name)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	issuedAt, _, _, err := parseSessionTimestamps(cookie.Value)
+	if err != nil || sm.MaxLifetime != 0 && !sm.now().Before(issuedAt.Add(sm.MaxLifetime)) {
+		return time.Time{}, false
+	}
+
+	return issuedAt, true
+}
+
+// Regenerate issues a fresh session cookie carrying over the data in sess. It should be called after
+// privilege changes, such as logging in, to prevent session fixation. If sess implements
+// IdentifiableSession it's assigned a new random ID before being written.
+//
+// Since the session is stored entirely in the cookie, previously issued cookies can't be revoked, but
+// they never carry data written after regeneration. The CSRF token, if configured, is rotated too, and
+// the issue time checked against MaxLifetime is reset.
+func (sm *CookieSessionManager) Regenerate(w http.ResponseWriter, req *http.Request, sess Session) error {
+	if is, ok := sess.(IdentifiableSession); ok {
+		id, err := randomToken()
+		if err != nil {
+			return err
+		}
+
+		is.SetSessionID(id)
+	}
+
+	if sm.CSRF != nil {
+		if _, err := sm.CSRF.Rotate(w); err != nil {
+			return err
+		}
+	}
+
+	return sm.update(w, req, sess, nil, true)
+}
+
+// Destroy clears the session, deleting its cookie.
+func (sm *CookieSessionManager) Destroy(w http.ResponseWriter) error {
+	_, err := sm.cm.Delete(w, sm.name, sm.opts)
+	return err
+}
+
+// timestamped reports whether the session expiration and issue time are stored inside the cookie.
+func (sm *CookieSessionManager) timestamped() bool {
+	return sm.ExpiresIn != 0 || sm.MaxLifetime != 0
+}
+
+func (sm *CookieSessionManager) now() time.Time {
+	if sm.Clock == nil {
+		return sm.cm.now()
+	}
+
+	return sm.Clock.Now()
+}
+
+// sessionEncoder wraps a CookieEncoder, prefixing the encoded session with the time it was issued and
+// the time it expires. Since they're encrypted along with the session they can't be tampered with.
+type sessionEncoder struct {
+	CookieEncoder
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+func (e *sessionEncoder) Encode(v interface{}, c *http.Cookie) error {
+	if err := e.CookieEncoder.Encode(v, c); err != nil {
+		return err
+	}
+
+	c.Value = strconv.FormatInt(e.IssuedAt.Unix(), 10) + "|" + strconv.FormatInt(e.ExpiresAt.Unix(), 10) + "|" + c.Value
+	return nil
+}
+
+func (e *sessionEncoder) Decode(v interface{}, c *http.Cookie) error {
+	issuedAt, expiresAt, value, err := parseSessionTimestamps(c.Value)
+	if err != nil {
+		return err
+	}
+
+	e.IssuedAt, e.ExpiresAt = issuedAt, expiresAt
+
+	c.Value = value
+	return e.CookieEncoder.Decode(v, c)
+}
+
+// parseSessionTimestamps splits the timestamps written by sessionEncoder from the encoded session.
+func parseSessionTimestamps(value string) (time.Time, time.Time, string, error) {
+	issuedAt, rest, ok := strings.Cut(value, "|")
+	if !ok {
+		return time.Time{}, time.Time{}, "", errors.New("cookies: missing session timestamps")
+	}
+
+	expiresAt, value, ok := strings.Cut(rest, "|")
+	if !ok {
+		return time.Time{}, time.Time{}, "", errors.New("cookies: missing session timestamps")
+	}
+
+	iat, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+
+	exp, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+
+	return time.Unix(iat, 0), time.Unix(exp, 0), value, nil
+}
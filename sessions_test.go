@@ -0,0 +1,166 @@
+package cookies
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// identifiableSession is a testSession holding an ID assigned by Regenerate.
+type identifiableSession struct {
+	testSession
+	ID string `json:"id"`
+}
+
+func (s *identifiableSession) SetSessionID(id string) { s.ID = id }
+
+// sessionCookie returns the session cookie written to rec.
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+
+	t.Fatal("no session cookie was written")
+	return nil
+}
+
+func TestCookieSessionManagerRegenerate(t *testing.T) {
+	sm := NewCookieSessionManager(newTestManager(), "session", nil)
+
+	rec := httptest.NewRecorder()
+	if err := sm.Update(rec, httptest.NewRequest(http.MethodGet, "/", nil), &identifiableSession{testSession: testSession{UserID: "42"}}); err != nil {
+		t.Fatal(err)
+	}
+	before := sessionCookie(t, rec)
+	req := requestWithCookies(rec)
+
+	var sess identifiableSession
+	if err := sm.Current(req, &sess); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := sm.Regenerate(rec, req, &sess); err != nil {
+		t.Fatal(err)
+	}
+	after := sessionCookie(t, rec)
+	if after.Value == before.Value {
+		t.Error("regenerating the session kept the cookie value")
+	}
+	if sess.ID == "" {
+		t.Error("regenerating the session didn't assign it an ID")
+	}
+
+	var regenerated identifiableSession
+	if err := sm.Current(requestWithCookies(rec), &regenerated); err != nil {
+		t.Fatal(err)
+	}
+	if regenerated != sess {
+		t.Errorf("regenerated session is %+v, want %+v", regenerated, sess)
+	}
+}
+
+func TestCookieSessionManagerDestroy(t *testing.T) {
+	sm := NewCookieSessionManager(newTestManager(), "session", &CookieOptions{Path: "/app"})
+
+	rec := httptest.NewRecorder()
+	if err := sm.Destroy(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := sessionCookie(t, rec)
+	if cookie.MaxAge >= 0 || cookie.Value != "" || cookie.Path != "/app" {
+		t.Errorf("destroying the session wrote %v, want an expired cookie for /app", cookie)
+	}
+}
+
+func TestSlidingSessionExpiresAtMaxLifetime(t *testing.T) {
+	issued := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issued
+	cm := newTestManager()
+	cm.Clock = ClockFunc(func() time.Time { return now })
+
+	sm := NewCookieSessionManager(cm, "session", nil)
+	sm.ExpiresIn = 30 * time.Minute
+	sm.MaxLifetime = 2 * time.Hour
+	sm.SlidingExpiration = true
+	sm.IdleTimeout = 30 * time.Minute
+
+	rec := httptest.NewRecorder()
+	if err := sm.Update(rec, httptest.NewRequest(http.MethodGet, "/", nil), &testSession{UserID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	req := requestWithCookies(rec)
+
+	// Refreshing every 20 minutes keeps the session alive, but not past its lifetime.
+	for now = issued.Add(20 * time.Minute); now.Before(issued.Add(sm.MaxLifetime)); now = now.Add(20 * time.Minute) {
+		rec := httptest.NewRecorder()
+		var sess testSession
+		if err := sm.CurrentAndRefresh(rec, req, &sess); err != nil {
+			t.Fatalf("after %s refreshing returned %v", now.Sub(issued), err)
+		}
+
+		req = requestWithCookies(rec)
+		if iat, ok := sm.issuedAt(req); !ok || !iat.Equal(issued) {
+			t.Fatalf("after %s the session was issued at %s, %t, want %s", now.Sub(issued), iat, ok, issued)
+		}
+		if cookie := sessionCookie(t, rec); cookie.MaxAge != 1800 {
+			t.Errorf("refreshed cookie has MaxAge %d, want 1800", cookie.MaxAge)
+		}
+	}
+
+	var sess testSession
+	if err := sm.CurrentAndRefresh(httptest.NewRecorder(), req, &sess); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("after %s reading the session returned %v, want ErrSessionExpired", now.Sub(issued), err)
+	}
+
+	// Without refreshes the session expires after ExpiresIn.
+	now = issued
+	rec = httptest.NewRecorder()
+	if err := sm.Update(rec, httptest.NewRequest(http.MethodGet, "/", nil), &testSession{UserID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	now = issued.Add(sm.ExpiresIn)
+	if err := sm.Current(requestWithCookies(rec), &sess); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("reading an idle session returned %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestRewriteOnRead(t *testing.T) {
+	old := &SecureCookieManager{Encryptor: NewCookieEncryptorWithOptions("old secret"), Encoder: JSONCookieEncoder{}}
+	cm := newTestManager()
+	cm.FallbackEncryptors = []*CookieEncryptor{old.Encryptor}
+
+	sm := NewCookieSessionManager(cm, "session", nil)
+	sm.RewriteOnRead = true
+
+	for _, tt := range []struct {
+		name      string
+		writer    *SecureCookieManager
+		rewritten bool
+	}{
+		{"current", cm, false},
+		{"fallback", old, true},
+	} {
+		rec := httptest.NewRecorder()
+		var sess testSession
+		rewritten, err := sm.CurrentAndRewrite(rec, setCookieRequest(t, tt.writer, "session", &testSession{UserID: "42"}), &sess)
+		if err != nil || rewritten != tt.rewritten {
+			t.Fatalf("%s: rewritten %t, %v, want %t", tt.name, rewritten, err, tt.rewritten)
+		}
+		if !rewritten {
+			continue
+		}
+
+		// The rewritten cookie uses the current secret.
+		if stale, err := cm.NeedsRewrite(requestWithCookies(rec), "session"); err != nil || stale {
+			t.Errorf("%s: rewritten cookie needs rewrite: %t, %v", tt.name, stale, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cookies
+
+import (
+	"net/http"
+	"sync"
+)
+
+// lazyEncryptor creates a CookieEncryptor on first use, so its keys are only derived when needed.
+type lazyEncryptor struct {
+	once  sync.Once
+	build func() *CookieEncryptor
+	ce    *CookieEncryptor
+}
+
+func (l *lazyEncryptor) get() *CookieEncryptor {
+	l.once.Do(func() {
+		l.ce = l.build()
+	})
+
+	return l.ce
+}
+
+// SignOnly returns an encryptor signing values without encrypting them, like one created using
+// WithCipher(SignOnly), with keys derived from the same secrets and otherwise the same options. Its
+// keys are derived on first call. Encryptors already using SignOnly return themselves.
+func (ce *CookieEncryptor) SignOnly() *CookieEncryptor {
+	if ce.signOnly == nil {
+		return ce
+	}
+
+	return ce.signOnly.get()
+}
+
+// SetSigned is like Set but only signs the cookie, using the sign-only counterpart of Encryptor, so
+// clients can read the value but not modify it. This allows mixing signed and encrypted cookies using
+// the same manager. Signed cookies must be read using GetSigned.
+func (cm *SecureCookieManager) SetSigned(w http.ResponseWriter, name string, opts *CookieOptions, v interface{}) (*http.Cookie, error) {
+	return cm.signOnly().Set(w, name, opts, v)
+}
+
+// GetSigned is like Get for cookies written using SetSigned.
+func (cm *SecureCookieManager) GetSigned(req *http.Request, name string, v interface{}) (*http.Cookie, error) {
+	return cm.signOnly().Get(req, name, v)
+}
+
+// signOnly returns a copy of cm using the sign-only counterparts of its encryptors.
+func (cm *SecureCookieManager) signOnly() *SecureCookieManager {
+	clone := cm.Clone()
+	clone.Encryptor = cm.Encryptor.SignOnly()
+	for i, ce := range clone.FallbackEncryptors {
+		clone.FallbackEncryptors[i] = ce.SignOnly()
+	}
+	clone.cacheOwner = cm.requestCacheOwner()
+
+	return clone
+}
@@ -0,0 +1,41 @@
+package cookies
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSignOnlyRejectsEncryptedMessages(t *testing.T) {
+	for _, opt := range []EncryptorOption{
+		WithSalts("encryption salt", "signing salt"),
+		WithSalts("", ""),
+		WithRailsSalts(RailsSalts{EncryptedSignedCookie: "salt", SignedCookie: "other salt"}),
+	} {
+		ce := NewCookieEncryptorWithOptions("secret", opt)
+
+		msg, err := ce.EncryptValue("value")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ce.SignOnly().DecryptValue(msg); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("SignOnly decrypted an encrypted message, returned %v, want ErrInvalidSignature", err)
+		}
+	}
+}
+
+func TestSignOnlyUsesSignedCookieSalt(t *testing.T) {
+	ce := NewCookieEncryptorWithOptions("secret", WithCipher(SignOnly), WithRailsSalts(RailsSalts{SignedCookie: "salt"}))
+
+	msg, err := ce.EncryptValue("value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCookieEncryptorWithOptions("secret", WithCipher(SignOnly)).DecryptValue(msg); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("verifying using the default salt returned %v, want ErrInvalidSignature", err)
+	}
+	if got, err := ce.DecryptValue(msg); err != nil || got != "value" {
+		t.Errorf("DecryptValue returned %q, %v", got, err)
+	}
+}
@@ -0,0 +1,75 @@
+package cookies
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// EncryptTo encodes v using the manager's Encoder, encrypts it and writes the result to w. It's meant
+// for persisting values outside of cookies, so no cookie attributes or size limits apply.
+//
+// Messages are authenticated as a whole, so the encrypted value is still built in memory before
+// being written.
+func (cm *SecureCookieManager) EncryptTo(w io.Writer, v interface{}) error {
+	var cookie http.Cookie
+	if err := cm.Encoder.Encode(v, &cookie); err != nil {
+		return err
+	}
+
+	msg, err := cm.Encryptor.EncryptBytes([]byte(cookie.Value))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, msg)
+	return err
+}
+
+// DefaultMaxStreamSize is the limit, in bytes, on messages read by DecryptFrom when MaxStreamSize isn't
+// set.
+const DefaultMaxStreamSize = 1 << 20
+
+// DecryptFrom reads a value written by EncryptTo from r, decrypts it and decodes it into v. The whole
+// message is read, and authenticated, before anything is decoded, so it's limited to MaxStreamSize.
+func (cm *SecureCookieManager) DecryptFrom(r io.Reader, v interface{}) error {
+	limit := cm.MaxStreamSize
+	if limit == 0 {
+		limit = DefaultMaxStreamSize
+	}
+
+	msg, err := readLimited(r, limit, ErrMessageTooLarge)
+	if err != nil {
+		return err
+	}
+
+	b, err := cm.Encryptor.DecryptBytes(string(msg))
+	if err != nil {
+		return err
+	}
+
+	if err := cm.Encoder.Decode(v, &http.Cookie{Value: string(b)}); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+	}
+
+	return nil
+}
+
+// readLimited reads r until EOF, failing with an error wrapping tooLarge once it yields more than limit
+// bytes. A negative limit disables it. Reading a byte past the limit tells readers exceeding it apart
+// from those filling it exactly.
+func readLimited(r io.Reader, limit int, tooLarge error) ([]byte, error) {
+	if limit < 0 {
+		return io.ReadAll(r)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", tooLarge, limit)
+	}
+
+	return b, nil
+}
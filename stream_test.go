@@ -0,0 +1,71 @@
+package cookies
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecryptFromLimitsSize(t *testing.T) {
+	cm := newTestManager()
+
+	var buf bytes.Buffer
+	if err := cm.EncryptTo(&buf, map[string]string{"value": "value"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+	if err := cm.DecryptFrom(bytes.NewReader(buf.Bytes()), &got); err != nil || got["value"] != "value" {
+		t.Fatalf("DecryptFrom returned %v, %v", got, err)
+	}
+
+	cm.MaxStreamSize = buf.Len()
+	if err := cm.DecryptFrom(bytes.NewReader(buf.Bytes()), &got); err != nil {
+		t.Errorf("DecryptFrom of a message filling MaxStreamSize returned %v", err)
+	}
+
+	cm.MaxStreamSize = buf.Len() - 1
+	if err := cm.DecryptFrom(bytes.NewReader(buf.Bytes()), &got); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("DecryptFrom of a message exceeding MaxStreamSize returned %v, want ErrMessageTooLarge", err)
+	}
+
+	cm.MaxStreamSize = 0
+	huge := io.MultiReader(strings.NewReader(strings.Repeat("a", DefaultMaxStreamSize)), strings.NewReader("a"))
+	if err := cm.DecryptFrom(huge, &got); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("DecryptFrom of a message exceeding DefaultMaxStreamSize returned %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	for _, tt := range []struct {
+		size, limit int
+		err         error
+	}{
+		{16, 16, nil},
+		{17, 16, ErrMessageTooLarge},
+		{0, 0, nil},
+		{1, 0, ErrMessageTooLarge},
+		{1 << 10, -1, nil},
+	} {
+		b, err := readLimited(strings.NewReader(strings.Repeat("x", tt.size)), tt.limit, ErrMessageTooLarge)
+		if !errors.Is(err, tt.err) || (err == nil && len(b) != tt.size) {
+			t.Errorf("reading %d bytes limited to %d returned %d bytes, %v, want %v", tt.size, tt.limit, len(b), err, tt.err)
+		}
+	}
+}
+
+func TestGzipTransformLimitsDecodedSize(t *testing.T) {
+	compressed, err := GzipTransform{}.Forward(bytes.Repeat([]byte("x"), 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (GzipTransform{MaxDecodedSize: 1023}).Reverse(compressed); !errors.Is(err, ErrDecodedTooLarge) {
+		t.Errorf("inflating past MaxDecodedSize returned %v, want ErrDecodedTooLarge", err)
+	}
+	if b, err := (GzipTransform{MaxDecodedSize: 1024}).Reverse(compressed); err != nil || len(b) != 1024 {
+		t.Errorf("inflating up to MaxDecodedSize returned %d bytes, %v", len(b), err)
+	}
+}
@@ -0,0 +1,67 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// TypedManager wraps a SecureCookieManager to Set and Get values of type T, letting the compiler
+// ensure cookies are always decoded into the right type.
+type TypedManager[T any] struct {
+	cm *SecureCookieManager
+}
+
+// NewTypedManager creates a new TypedManager for values of type T backed by cm.
+func NewTypedManager[T any](cm *SecureCookieManager) *TypedManager[T] {
+	return &TypedManager[T]{cm}
+}
+
+// Set a cookie with the data set to the encrypted version of the serialization of v.
+// Returns the http.Cookie generated.
+func (tm *TypedManager[T]) Set(w http.ResponseWriter, name string, opts *CookieOptions, v T) (*http.Cookie, error) {
+	return tm.cm.Set(w, name, opts, v)
+}
+
+// Get gets the Cookie, decrypts it and returns its deserialized value.
+func (tm *TypedManager[T]) Get(req *http.Request, name string) (T, error) {
+	var v T
+
+	_, err := tm.cm.Get(req, name, &v)
+	return v, err
+}
+
+// Delete deletes the Cookie, setting value to empty and expiring in the past.
+func (tm *TypedManager[T]) Delete(w http.ResponseWriter, name string, opts *CookieOptions) (*http.Cookie, error) {
+	return tm.cm.Delete(w, name, opts)
+}
+
+// GenericSessionManager wraps a SessionManager to return sessions of type T, a pointer to a session
+// struct, so callers don't allocate the session Current decodes into. Storing sessions is left to the
+// wrapped manager.
+type GenericSessionManager[T Session] struct {
+	sessions SessionManager
+}
+
+// NewGenericSessionManager creates a new GenericSessionManager for sessions of type T backed by
+// sessions. It panics if T isn't a pointer type, since sessions couldn't be decoded into it.
+func NewGenericSessionManager[T Session](sessions SessionManager) *GenericSessionManager[T] {
+	if t := reflect.TypeOf((*T)(nil)).Elem(); t.Kind() != reflect.Pointer {
+		panic(fmt.Sprintf("cookies: GenericSessionManager requires a pointer session type, got %s", t))
+	}
+
+	return &GenericSessionManager[T]{sessions}
+}
+
+// Current fetches the current session, decoding it into a newly allocated T.
+func (gm *GenericSessionManager[T]) Current(req *http.Request) (T, error) {
+	sess := reflect.New(reflect.TypeOf((*T)(nil)).Elem().Elem()).Interface().(T)
+
+	err := gm.sessions.Current(req, sess)
+	return sess, err
+}
+
+// Update updates the session, replacing the existing session data with sess.
+func (gm *GenericSessionManager[T]) Update(w http.ResponseWriter, req *http.Request, sess T) error {
+	return gm.sessions.Update(w, req, sess)
+}
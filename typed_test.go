@@ -0,0 +1,41 @@
+package cookies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type valueSession struct{}
+
+func (valueSession) Validate(*http.Request) error { return nil }
+
+func TestGenericSessionManager(t *testing.T) {
+	sessions := NewCookieSessionManager(newTestManager(), "session", nil)
+	gm := NewGenericSessionManager[*testSession](sessions)
+
+	rec := httptest.NewRecorder()
+	if err := gm.Update(rec, httptest.NewRequest(http.MethodGet, "/", nil), &testSession{UserID: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	sess, err := gm.Current(req)
+	if err != nil || sess.UserID != "42" {
+		t.Errorf("Current returned %+v, %v", sess, err)
+	}
+}
+
+func TestGenericSessionManagerRejectsValueTypes(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewGenericSessionManager accepted a non-pointer session type")
+		}
+	}()
+
+	NewGenericSessionManager[valueSession](NewCookieSessionManager(newTestManager(), "session", nil))
+}
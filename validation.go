@@ -0,0 +1,188 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SameSiteNonePolicy defines how Set handles cookies using SameSite=None without Secure, which
+// browsers reject.
+type SameSiteNonePolicy int
+
+const (
+	// RejectInsecureSameSiteNone makes Set return an error wrapping ErrInsecureSameSiteNone.
+	RejectInsecureSameSiteNone SameSiteNonePolicy = iota
+	// ForceSecureSameSiteNone makes Set mark the cookie as Secure.
+	ForceSecureSameSiteNone
+)
+
+// SubSecondMaxAgePolicy defines how Set handles a MaxAge between zero and one second, which would
+// otherwise be truncated to zero, making the cookie last until the browser is closed.
+type SubSecondMaxAgePolicy int
+
+const (
+	// RejectSubSecondMaxAge makes Set return an error wrapping ErrInvalidMaxAge.
+	RejectSubSecondMaxAge SubSecondMaxAgePolicy = iota
+	// RoundUpSubSecondMaxAge makes Set use a Max-Age of one second.
+	RoundUpSubSecondMaxAge
+)
+
+// validateMaxAge checks the MaxAge set by opts survives being truncated to whole seconds in cookie,
+// correcting it when the manager is configured to do so.
+func (cm *SecureCookieManager) validateMaxAge(cookie *http.Cookie, opts *CookieOptions) error {
+	if opts == nil || opts.SessionOnly || opts.MaxAge <= 0 || opts.MaxAge >= time.Second {
+		return nil
+	}
+
+	switch cm.SubSecondMaxAgePolicy {
+	case RoundUpSubSecondMaxAge:
+		cookie.MaxAge = 1
+		return nil
+	default:
+		return fmt.Errorf("%w: %q has a MaxAge of %s, below one second", ErrInvalidMaxAge, cookie.Name, opts.MaxAge)
+	}
+}
+
+// validate checks cookie is going to be accepted by browsers, correcting it when the manager is
+// configured to do so.
+func (cm *SecureCookieManager) validate(cookie *http.Cookie) error {
+	if !isCookieName(cookie.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidCookieName, cookie.Name)
+	}
+
+	if err := validateAttributes(cookie); err != nil {
+		return err
+	}
+
+	if err := validateUnparsed(cookie); err != nil {
+		return err
+	}
+
+	if err := validatePriority(cookie); err != nil {
+		return err
+	}
+
+	if cookie.SameSite < 0 || cookie.SameSite > http.SameSiteNoneMode {
+		return fmt.Errorf("%w: %q has an unknown SameSite mode %d", ErrInvalidCookieAttribute, cookie.Name, cookie.SameSite)
+	}
+
+	if cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure {
+		switch cm.SameSiteNonePolicy {
+		case ForceSecureSameSiteNone:
+			cookie.Secure = true
+		default:
+			return fmt.Errorf("%w: %q", ErrInsecureSameSiteNone, cookie.Name)
+		}
+	}
+
+	if hasPrefixFold(cookie.Name, "__Secure-") && !cookie.Secure {
+		return fmt.Errorf("%w: %q must be Secure", ErrInvalidCookiePrefix, cookie.Name)
+	}
+
+	if hasPrefixFold(cookie.Name, "__Host-") {
+		switch {
+		case !cookie.Secure:
+			return fmt.Errorf("%w: %q must be Secure", ErrInvalidCookiePrefix, cookie.Name)
+		case cookie.Domain != "":
+			return fmt.Errorf("%w: %q must not set a Domain", ErrInvalidCookiePrefix, cookie.Name)
+		case cookie.Path != "/":
+			return fmt.Errorf("%w: %q must use Path=/", ErrInvalidCookiePrefix, cookie.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateAttributes checks the Domain and Path don't contain characters that could inject headers or
+// further attributes. http.Cookie would otherwise silently drop them.
+func validateAttributes(cookie *http.Cookie) error {
+	if !isAttributeValue(cookie.Domain) {
+		return fmt.Errorf("%w: %q has an invalid Domain %q", ErrInvalidCookieAttribute, cookie.Name, cookie.Domain)
+	}
+
+	if !isAttributeValue(cookie.Path) {
+		return fmt.Errorf("%w: %q has an invalid Path %q", ErrInvalidCookieAttribute, cookie.Name, cookie.Path)
+	}
+
+	return nil
+}
+
+// validateUnparsed checks each extra attribute is a single attribute without characters that could
+// inject headers or further attributes.
+func validateUnparsed(cookie *http.Cookie) error {
+	for _, attr := range cookie.Unparsed {
+		if attr == "" || !isAttributeValue(attr) {
+			return fmt.Errorf("%w: %q has an invalid attribute %q", ErrInvalidCookieAttribute, cookie.Name, attr)
+		}
+	}
+
+	return nil
+}
+
+// isAttributeValue reports whether s can be written in a Set-Cookie attribute, which excludes control
+// characters and semicolons.
+func isAttributeValue(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return r < 0x20 || r == 0x7f || r == ';'
+	})
+}
+
+// validatePriority checks the Priority attribute added by CookieOptions, if any, is a known one.
+func validatePriority(cookie *http.Cookie) error {
+	for _, attr := range cookie.Unparsed {
+		if p, ok := strings.CutPrefix(attr, "Priority="); ok {
+			switch CookiePriority(p) {
+			case PriorityLow, PriorityMedium, PriorityHigh:
+			default:
+				return fmt.Errorf("%w: %q has an unknown Priority %q", ErrInvalidCookieAttribute, cookie.Name, p)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateValue checks the serialized cookie value only contains characters allowed by RFC 6265, so
+// it doesn't need quoting that could confuse parsers.
+func validateValue(cookie *http.Cookie) error {
+	for i := 0; i < len(cookie.Value); i++ {
+		if !isCookieOctet(cookie.Value[i]) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidCookieValue, cookie.Name, cookie.Value[i])
+		}
+	}
+
+	return nil
+}
+
+// isCookieName reports whether name is a valid RFC 6265 cookie-name, which is an RFC 2616 token.
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCookieOctet reports whether c is an RFC 6265 cookie-octet: US-ASCII excluding controls,
+// whitespace, double quotes, commas, semicolons and backslashes.
+func isCookieOctet(c byte) bool {
+	return c == 0x21 || (0x23 <= c && c <= 0x2b) || (0x2d <= c && c <= 0x3a) || (0x3c <= c && c <= 0x5b) || (0x5d <= c && c <= 0x7e)
+}
+
+// hasPrefixFold reports whether s begins with prefix ignoring case, which is how browsers match cookie
+// name prefixes.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
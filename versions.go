@@ -0,0 +1,103 @@
+package cookies
+
+import (
+	"fmt"
+	"sync"
+)
+
+// versionMarker starts the two-byte version header of values encrypted using the versioned format,
+// followed by the version as an ASCII digit. It can't appear at the start of unversioned values, which
+// are base64 or hex encoded.
+const versionMarker = '$'
+
+// formatVersion describes how values carrying a given version header are encrypted. Versions are
+// the position in formatVersions, so new versions must only be appended. Since the header holds a
+// single digit, there can be at most 10 versions.
+type formatVersion struct {
+	mode   CipherMode
+	digest HMACDigest
+}
+
+var formatVersions = []formatVersion{
+	{mode: CBC, digest: SHA1},
+	{mode: GCM},
+	{mode: SignOnly, digest: SHA1},
+	{mode: CBC, digest: SHA256},
+	{mode: SignOnly, digest: SHA256},
+}
+
+// matches reports whether values encrypted using c carry the version fv. The digest doesn't apply to
+// GCM.
+func (fv formatVersion) matches(c *encryptorConfig) bool {
+	return fv.mode == c.mode && (c.mode == GCM || fv.digest == c.digest)
+}
+
+// versionedCiphers holds the ciphers used by a CookieEncryptor using the versioned format. The ciphers
+// for versions other than the one written are only created, deriving their keys, when a value using
+// them is read.
+type versionedCiphers struct {
+	version int
+	secret  string
+	config  encryptorConfig
+
+	mu      sync.Mutex
+	ciphers map[int][]messageCipher
+}
+
+func newVersionedCiphers(secret string, c *encryptorConfig, current []messageCipher) *versionedCiphers {
+	vc := &versionedCiphers{
+		version: -1,
+		secret:  secret,
+		config:  *c,
+		ciphers: map[int][]messageCipher{},
+	}
+
+	for version, fv := range formatVersions {
+		if fv.matches(c) {
+			vc.version = version
+			vc.ciphers[version] = current
+		}
+	}
+
+	if vc.version < 0 {
+		panic(fmt.Sprintf("cookies: cipher mode %d with digest %d has no format version", c.mode, c.digest))
+	}
+
+	return vc
+}
+
+// header returns the version header prepended to encrypted values.
+func (vc *versionedCiphers) header() string {
+	return string([]byte{versionMarker, '0' + byte(vc.version)})
+}
+
+// parse splits the version header from msg, returning the ciphers for the version, the current secret
+// first, and the rest of the message. Messages without a header are unversioned, and are handled by
+// the ciphers for the version being written.
+func (vc *versionedCiphers) parse(msg string) ([]messageCipher, string, error) {
+	if len(msg) == 0 || msg[0] != versionMarker {
+		return vc.forVersion(vc.version), msg, nil
+	}
+
+	if len(msg) < 2 || msg[1] < '0' || int(msg[1]-'0') >= len(formatVersions) {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownFormatVersion, msg[:min(len(msg), 2)])
+	}
+
+	return vc.forVersion(int(msg[1] - '0')), msg[2:], nil
+}
+
+func (vc *versionedCiphers) forVersion(version int) []messageCipher {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	if ciphers, ok := vc.ciphers[version]; ok {
+		return ciphers
+	}
+
+	c := vc.config
+	c.mode, c.digest = formatVersions[version].mode, formatVersions[version].digest
+
+	ciphers := newCiphers(vc.secret, &c)
+	vc.ciphers[version] = ciphers
+	return ciphers
+}
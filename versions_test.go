@@ -0,0 +1,36 @@
+package cookies
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatVersionsFitHeader(t *testing.T) {
+	if len(formatVersions) > 10 {
+		t.Fatalf("%d format versions, the header holds at most 10", len(formatVersions))
+	}
+}
+
+func TestVersionedFormatReadsEveryVersion(t *testing.T) {
+	reader := NewCookieEncryptorWithOptions("secret", WithVersionedFormat())
+
+	for version, fv := range formatVersions {
+		writer := NewCookieEncryptorWithOptions("secret", WithVersionedFormat(), WithCipher(fv.mode), WithDigest(fv.digest))
+
+		msg, err := writer.EncryptValue("value")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header := writer.versions.header(); len(header) != 2 || msg[:2] != header {
+			t.Errorf("version %d: message %q doesn't start with header %q", version, msg, header)
+		}
+
+		if got, err := reader.DecryptValue(msg); err != nil || got != "value" {
+			t.Errorf("version %d: decrypted %q, %v", version, got, err)
+		}
+	}
+
+	if _, err := reader.DecryptValue("$9value"); !errors.Is(err, ErrUnknownFormatVersion) {
+		t.Errorf("decrypting an unknown version returned %v, want ErrUnknownFormatVersion", err)
+	}
+}